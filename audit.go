@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultAuditMaxMB is the size at which AUDIT_FILE is rotated (AUDIT_MAX_MB)
+const defaultAuditMaxMB = 100
+
+// auditRecord is one line of AUDIT_FILE
+type auditRecord struct {
+	Time          time.Time `json:"time"`
+	Relay         int       `json:"relay"`
+	RepoKey       string    `json:"repo_key"`
+	RoutingKey    string    `json:"routing_key"`
+	DeliveryID    string    `json:"delivery_id"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	PayloadSHA256 string    `json:"payload_sha256"`
+	Targets       []string  `json:"targets"` // redacted like in the logs: the accepting targets, or every target tried when failed
+	Result        string    `json:"result"`  // "delivered" or "failed"
+	StatusCode    int       `json:"status_code"`
+	Attempts      int       `json:"attempts"`
+	Error         string    `json:"error,omitempty"`
+	Injected      bool      `json:"injected,omitempty"` // sent through /inject
+	DryRun        bool      `json:"dry_run,omitempty"`
+}
+
+// auditLog appends one JSON line per forwarded message to AUDIT_FILE, separate from the operational logs.
+// 감사 기록이므로 줄마다 fsync 하고, 크기가 넘으면 이름을 바꿔 보관할 뿐 지우지 않는다.
+type auditLog struct {
+	path     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// audit is nil unless AUDIT_FILE is set
+var audit *auditLog
+
+// newAuditLog opens (or creates) the audit file for appending. maxBytes is the size at which it is rotated.
+func newAuditLog(path string, maxBytes int64) (*auditLog, error) {
+	a := &auditLog{path: path, maxBytes: maxBytes}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *auditLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	a.file, a.size = file, info.Size()
+	return nil
+}
+
+// Record appends the outcome of forwarding d. delivery is the X-GitHub-Delivery sent to the targets.
+// Failures are logged; they never fail the delivery.
+func (a *auditLog) Record(ctx context.Context, d amqp.Delivery, delivery string, config RelayConfig, result postResult) {
+	if a == nil {
+		return
+	}
+	sum := sha256.Sum256(d.Body)
+	record := auditRecord{
+		Time:          time.Now().UTC(),
+		Relay:         config.Index,
+		RepoKey:       config.RepoKey,
+		RoutingKey:    d.RoutingKey,
+		DeliveryID:    delivery,
+		PayloadSHA256: hex.EncodeToString(sum[:]),
+		Targets:       redactURLs(result.Accepted),
+		Result:        "delivered",
+		StatusCode:    result.StatusCode,
+		Attempts:      result.Attempts,
+		Injected:      isInjected(ctx),
+		DryRun:        config.DryRun,
+	}
+	record.CorrelationID, _ = ctx.Value(correlationKey{}).(string)
+	if result.Err != nil {
+		record.Result = "failed"
+		// 실패하면 모든 대상에 보내 봤다 (roundrobin도 다음 대상으로 넘어간다).
+		record.Targets = redactURLs(config.TargetURLs)
+		record.Error = result.Err.Error()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		slog.Error("Encoding audit record failed", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.write(line); err != nil {
+		slog.Error("Writing AUDIT_FILE failed", "file", a.path, "delivery_id", record.DeliveryID, "error", err)
+	}
+}
+
+// write appends line and syncs it to disk, rotating first when the file would exceed maxBytes. a.mu must be held.
+func (a *auditLog) write(line []byte) error {
+	if a.file == nil {
+		// 이전 회전에서 다시 열지 못했다.
+		if err := a.open(); err != nil {
+			return err
+		}
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// rotate renames the full file to "<AUDIT_FILE>.<UTC time>" and starts a new one. a.mu must be held.
+func (a *auditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		slog.Warn("Closing AUDIT_FILE failed", "file", a.path, "error", err)
+	}
+	a.file = nil
+	rotated := fmt.Sprintf("%s.%s", a.path, time.Now().UTC().Format("20060102T150405.000000000Z"))
+	if err := os.Rename(a.path, rotated); err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+	slog.Info("Rotated AUDIT_FILE", "file", a.path, "rotated_to", rotated)
+	return a.open()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"time"
+)
+
+// reconnectBackoff computes exponential reconnect delays with jitter.
+// 모든 릴레이가 브로커 재시작 후 같은 시점에 재접속하지 않도록 지연 시간을 흩뿌린다.
+type reconnectBackoff struct {
+	Base       time.Duration // RMQ_RECONNECT_BASE_SECONDS - first retry delay
+	Max        time.Duration // RMQ_RECONNECT_MAX_SECONDS - upper bound of the retry delay
+	Multiplier float64       // RMQ_RECONNECT_MULTIPLIER - growth factor per consecutive failure
+	ResetAfter time.Duration // RMQ_RECONNECT_RESET_SECONDS - connection uptime after which the delay resets to Base
+
+	current time.Duration
+}
+
+// loadReconnectBackoff reads the backoff settings from environment variables.
+// RMQ_RECONNECT_INTERVAL_SECONDS is a shorthand for a fixed interval (the default of both Base and Max).
+func loadReconnectBackoff() reconnectBackoff {
+	baseSeconds, maxSeconds := 1, 60
+	if os.Getenv("RMQ_RECONNECT_INTERVAL_SECONDS") != "" {
+		interval := envPositiveInt("RMQ_RECONNECT_INTERVAL_SECONDS", 60)
+		baseSeconds, maxSeconds = interval, interval
+	}
+
+	b := reconnectBackoff{
+		Base:       time.Duration(envPositiveInt("RMQ_RECONNECT_BASE_SECONDS", baseSeconds)) * time.Second,
+		Max:        time.Duration(envPositiveInt("RMQ_RECONNECT_MAX_SECONDS", maxSeconds)) * time.Second,
+		Multiplier: envPositiveFloat("RMQ_RECONNECT_MULTIPLIER", 2),
+		ResetAfter: time.Duration(envPositiveInt("RMQ_RECONNECT_RESET_SECONDS", 60)) * time.Second,
+	}
+	if b.Max < b.Base {
+		b.Max = b.Base
+	}
+	return b
+}
+
+// Next returns the delay before the next reconnect attempt and advances the backoff.
+// The returned delay is between half and the full current interval.
+func (b *reconnectBackoff) Next() time.Duration {
+	if b.current < b.Base {
+		b.current = b.Base
+	}
+
+	interval := b.current
+	half := interval / 2
+	delay := half + time.Duration(rand.Int63n(int64(interval-half)+1))
+
+	next := time.Duration(float64(b.current) * b.Multiplier)
+	if next > b.Max || next <= 0 {
+		next = b.Max
+	}
+	b.current = next
+
+	return delay
+}
+
+// Reset restarts the backoff from Base
+func (b *reconnectBackoff) Reset() {
+	b.current = b.Base
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Supported BACKPRESSURE_MODE values: what happens to new messages while the relay is still forwarding
+const (
+	backpressureBlock      = "block"       // leave them with the broker/client library until the relay is free (default)
+	backpressureDropOldest = "drop-oldest" // keep the newest BACKPRESSURE_BUFFER messages, drop the oldest waiting one
+	backpressureDropNewest = "drop-newest" // keep the oldest BACKPRESSURE_BUFFER messages, drop the incoming one
+)
+
+// defaultBackpressureBuffer is how many messages may wait for the relay in the drop modes (BACKPRESSURE_BUFFER)
+const defaultBackpressureBuffer = 100
+
+var supportedBackpressureModes = []string{backpressureBlock, backpressureDropOldest, backpressureDropNewest}
+
+// normalizeBackpressureMode lower-cases BACKPRESSURE_MODE, defaulting to block.
+// Unsupported values are kept so validateRelayConfig can reject them.
+func normalizeBackpressureMode(mode string) string {
+	if mode == "" {
+		return backpressureBlock
+	}
+	return strings.ToLower(mode)
+}
+
+// applyBackpressure returns the channel the consume loop reads instead of deliveries.
+// In block mode that is deliveries itself. In the drop modes a goroutine moves messages into a buffer of
+// BACKPRESSURE_BUFFER and, while it is full, drops one message per incoming message: dropped messages are
+// acked with MANUAL_ACK (they are not requeued) and counted in relay_backpressure_dropped_total.
+// The returned channel is closed after deliveries is closed; the goroutine also stops when stop is closed.
+// auto-ack에서는 브로커가 보내는 대로 클라이언트 라이브러리가 메모리에 쌓으므로, 지연에 민감한 설정에서 오래된 트리거를 버릴 수 있게 한다.
+func applyBackpressure(deliveries <-chan amqp.Delivery, stop <-chan struct{}, config RelayConfig, manualAck bool, logger *slog.Logger) <-chan amqp.Delivery {
+	if config.BackpressureMode == backpressureBlock {
+		return deliveries
+	}
+
+	drop := func(d amqp.Delivery) {
+		logger.Warn("Relay is busy and BACKPRESSURE_BUFFER is full. Message dropped.", "mode", config.BackpressureMode,
+			"routing_key", d.RoutingKey, "delivery_id", deliveryHeader(d, "X-GitHub-Delivery"))
+		backpressureDropped.WithLabelValues(relayLabelValues(config)...).Inc()
+		if manualAck {
+			if err := d.Ack(false); err != nil {
+				logger.Warn("Acking dropped message failed", "error", err)
+			}
+		}
+	}
+
+	buffered := make(chan amqp.Delivery, config.BackpressureBuffer)
+	go func() {
+		defer close(buffered)
+		for {
+			var d amqp.Delivery
+			var ok bool
+			select {
+			case d, ok = <-deliveries:
+				if !ok {
+					return
+				}
+			case <-stop:
+				return
+			}
+
+			select {
+			case buffered <- d:
+				continue
+			default:
+			}
+			if config.BackpressureMode == backpressureDropNewest {
+				drop(d)
+				continue
+			}
+			// drop-oldest: 가장 오래 기다린 메시지를 꺼내 버리고 새 메시지를 넣는다.
+			// 버퍼에 쓰는 것은 이 goroutine뿐이므로 하나를 꺼낸 뒤의 전송은 막히지 않는다.
+			select {
+			case oldest := <-buffered:
+				drop(oldest)
+			default:
+				// 그사이 consume 루프가 가져가 버퍼가 비었다.
+			}
+			buffered <- d
+		}
+	}()
+	return buffered
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestApplyBackpressure(t *testing.T) {
+	tests := []struct {
+		mode      string
+		manualAck bool
+		wantKept  []uint64 // handed to the consume loop, in order
+		wantAcked []uint64 // dropped and acked so the broker does not redeliver them
+	}{
+		{mode: backpressureBlock, manualAck: true, wantKept: []uint64{1, 2, 3, 4, 5}},
+		{mode: backpressureDropOldest, manualAck: true, wantKept: []uint64{4, 5}, wantAcked: []uint64{1, 2, 3}},
+		{mode: backpressureDropNewest, manualAck: true, wantKept: []uint64{1, 2}, wantAcked: []uint64{3, 4, 5}},
+		// auto-ack에서는 브로커가 이미 ack 했으므로 버린 메시지를 다시 ack 하지 않는다.
+		{mode: backpressureDropOldest, manualAck: false, wantKept: []uint64{4, 5}},
+		{mode: backpressureDropNewest, manualAck: false, wantKept: []uint64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s manual_ack=%t", tt.mode, tt.manualAck), func(t *testing.T) {
+			config := testRelayConfig("http://ci.example.com/github-webhook/")
+			config.BackpressureMode, config.BackpressureBuffer = tt.mode, 2
+			before := counterValue(t, "relay_backpressure_dropped_total", config)
+
+			acks := newFakeAcknowledger()
+			deliveries := make(chan amqp.Delivery, 5)
+			stop := make(chan struct{})
+			defer close(stop)
+			buffered := applyBackpressure(deliveries, stop, config, tt.manualAck, slog.Default())
+			if tt.mode == backpressureBlock && buffered != (<-chan amqp.Delivery)(deliveries) {
+				t.Error("block mode must hand the deliveries to the consume loop unchanged")
+			}
+
+			// 전달 중인 consume 루프처럼 아무것도 꺼내지 않는 동안 다섯 개가 들어온다.
+			for tag := uint64(1); tag <= 5; tag++ {
+				deliveries <- acks.delivery(tag, `{}`)
+			}
+			close(deliveries)
+			dropped := float64(5 - len(tt.wantKept))
+			waitFor(t, func() bool { return counterValue(t, "relay_backpressure_dropped_total", config) == before+dropped })
+
+			var kept []uint64
+			for d := range buffered {
+				kept = append(kept, d.DeliveryTag)
+			}
+			if !slices.Equal(kept, tt.wantKept) {
+				t.Errorf("consume loop got %v, want %v", kept, tt.wantKept)
+			}
+			for tag := uint64(1); tag <= 5; tag++ {
+				want := ""
+				if slices.Contains(tt.wantAcked, tag) {
+					want = "ack"
+				}
+				if got := acks.Outcome(tag); got != want {
+					t.Errorf("delivery %d settled with %q, want %q", tag, got, want)
+				}
+			}
+		})
+	}
+}
+
+// waitFor polls condition until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCircuitCooldownSeconds is how long an open circuit rejects requests (RELAY_CIRCUIT_COOLDOWN_SECONDS)
+const defaultCircuitCooldownSeconds = 30
+
+// errCircuitOpen is returned without sending anything while a target's circuit is open
+type errCircuitOpen struct {
+	RetryIn time.Duration // time left until the next probe request is allowed
+}
+
+func (e errCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit open for target, next probe in %v", e.RetryIn.Round(time.Second))
+}
+
+// circuitBreaker stops requests to a target after Threshold consecutive failures (RELAY_CIRCUIT_THRESHOLD).
+// 열린 뒤 Cooldown이 지나면 요청 하나만 시험으로 보내고, 성공하면 닫고 실패하면 다시 연다.
+type circuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int       // consecutive failures
+	openedAt time.Time // zero while closed
+	probing  bool      // a probe request is in flight (half-open)
+}
+
+// Allow reports whether a request may be sent now. When the circuit is open it returns the time
+// left until the next probe.
+func (b *circuitBreaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true, 0
+	}
+	if wait := b.Cooldown - time.Since(b.openedAt); wait > 0 {
+		return false, wait
+	}
+	if b.probing {
+		return false, b.Cooldown
+	}
+	b.probing = true
+	return true, 0
+}
+
+// Record updates the circuit with the outcome of an allowed request.
+// Returns true when the call changed the circuit between open and closed.
+func (b *circuitBreaker) Record(success bool) (changed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasOpen := !b.openedAt.IsZero()
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return wasOpen
+	}
+
+	b.failures++
+	if wasOpen || b.failures >= b.Threshold {
+		// 시험 요청이 실패했으면 쿨다운을 처음부터 다시 센다.
+		b.openedAt = time.Now()
+		return !wasOpen
+	}
+	return false
+}
+
+// IsOpen reports whether the circuit currently rejects requests (including while a probe is in flight)
+func (b *circuitBreaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openedAt.IsZero()
+}
+
+// circuitBreakerRegistry holds one breaker per relay and target URL, shared by all messages
+type circuitBreakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+var circuitBreakers = &circuitBreakerRegistry{breakers: map[string]*circuitBreaker{}}
+
+// For returns the breaker of targetURL for the relay, or nil when RELAY_CIRCUIT_THRESHOLD is 0
+func (r *circuitBreakerRegistry) For(config RelayConfig, targetURL string) *circuitBreaker {
+	if config.CircuitThreshold <= 0 {
+		return nil
+	}
+	key := strconv.Itoa(config.Index) + "\x00" + targetURL
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	breaker, ok := r.breakers[key]
+	if !ok {
+		breaker = &circuitBreaker{
+			Threshold: config.CircuitThreshold,
+			Cooldown:  time.Duration(config.CircuitCooldownSeconds) * time.Second,
+		}
+		r.breakers[key] = breaker
+	}
+	return breaker
+}
+
+// Forget drops the relay's breakers so a restarted relay starts with closed circuits and its current settings
+func (r *circuitBreakerRegistry) Forget(config RelayConfig) {
+	prefix := strconv.Itoa(config.Index) + "\x00"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, breaker := range r.breakers {
+		if targetURL, ok := strings.CutPrefix(key, prefix); ok {
+			if breaker.IsOpen() {
+				recordCircuitState(config, targetURL, false)
+			}
+			delete(r.breakers, key)
+		}
+	}
+}
+
+// OpenTargets returns the hosts of the relay's targets whose circuit is open, for /status
+func (r *circuitBreakerRegistry) OpenTargets(index int) []string {
+	prefix := strconv.Itoa(index) + "\x00"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var hosts []string
+	for key, breaker := range r.breakers {
+		if targetURL, ok := strings.CutPrefix(key, prefix); ok && breaker.IsOpen() {
+			hosts = append(hosts, urlHost(targetURL))
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
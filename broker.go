@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// brokerChannel is the part of *amqp.Channel used by the consume loop (wrapped in amqpChannel).
+// consumeRelay only talks to the broker through it, so the loop can be driven by a fake channel
+// (deliveries with a fake amqp.Acknowledger) without a running RabbitMQ.
+type brokerChannel interface {
+	Confirm(noWait bool) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	NotifyCancel(c chan string) chan string
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (publishConfirmation, error)
+}
+
+// publishConfirmation is the broker's pending answer to a publish in confirm mode.
+// *amqp.DeferredConfirmation implements it; a fake can ack, nack or time out.
+type publishConfirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// amqpChannel adapts *amqp.Channel to brokerChannel
+type amqpChannel struct {
+	*amqp.Channel
+}
+
+// PublishWithDeferredConfirmWithContext publishes msg and returns its pending confirmation
+func (c amqpChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (publishConfirmation, error) {
+	confirm, err := c.Channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	if err != nil {
+		return nil, err
+	}
+	// confirm 모드가 아니면 nil이 온다. 인터페이스에 nil 포인터를 담으면 nil 검사를 통과해 버린다.
+	if confirm == nil {
+		return nil, errors.New("channel is not in confirm mode")
+	}
+	return confirm, nil
+}
+
+// httpDoer sends the forward requests. *http.Client implements it; a fake can record requests
+// and return canned responses to exercise postToUrl.
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var (
+	_ brokerChannel = amqpChannel{}
+	_ httpDoer      = (*http.Client)(nil)
+)
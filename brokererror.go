@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Supported RMQ_FATAL_ERROR_POLICY values: what a relay does after a fatal broker error
+const (
+	fatalPolicyRetry = "retry" // keep reconnecting like after a transient error (default)
+	fatalPolicyStop  = "stop"  // stop the relay; the process exits 1 once every relay stopped or gave up
+	fatalPolicyExit  = "exit"  // shut down the whole process with exit code 1
+)
+
+// errFatalBrokerError is the shutdown cause when a relay hit a fatal broker error with RMQ_FATAL_ERROR_POLICY=exit
+var errFatalBrokerError = errors.New("fatal broker error")
+
+// loadFatalErrorPolicy reads RMQ_FATAL_ERROR_POLICY, warning and using "retry" for unsupported values
+func loadFatalErrorPolicy() string {
+	policy := strings.ToLower(os.Getenv("RMQ_FATAL_ERROR_POLICY"))
+	switch policy {
+	case fatalPolicyRetry, fatalPolicyStop, fatalPolicyExit:
+		return policy
+	case "":
+		return fatalPolicyRetry
+	default:
+		slog.Warn("Invalid value. Using default.", "name", "RMQ_FATAL_ERROR_POLICY", "value", policy, "default", fatalPolicyRetry)
+		return fatalPolicyRetry
+	}
+}
+
+// isFatalBrokerError reports whether err is an AMQP error that reconnecting cannot fix:
+// authentication or vhost access refused, exchange not found, queue declared with different arguments, not allowed.
+// Network errors and connection/channel closes are transient.
+// 익스체인지는 github-org-webhook-center가 선언하므로, 센터보다 먼저 뜨면 NOT_FOUND가 잠깐 날 수 있다 (그래서 기본 정책은 retry).
+func isFatalBrokerError(err error, config RelayConfig) bool {
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) || amqpErr == nil {
+		return false
+	}
+	switch amqpErr.Code {
+	case amqp.AccessRefused:
+		if errors.Is(err, amqp.ErrCredentials) || errors.Is(err, amqp.ErrVhost) || errors.Is(err, amqp.ErrSASL) {
+			return true
+		}
+		// RMQ_CONSUMER_EXCLUSIVE의 대기 인스턴스는 다른 인스턴스가 소비하는 동안 ACCESS_REFUSED를 받으며 기다린다.
+		return !config.ConsumerExclusive
+	case amqp.NotFound, amqp.PreconditionFailed, amqp.NotAllowed:
+		return true
+	default:
+		return false
+	}
+}
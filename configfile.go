@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// relayFile is the layout of RELAY_CONFIG_FILE. JSON files are read by the same parser
+// since JSON is valid YAML.
+//
+//	relays:
+//	  - repo_key: CommonTeam/GoodProj
+//	    target_url: https://example.com/jenkins/github-webhook/
+//	    timeout: 30
+//	    headers:
+//	      X-Source: github-relay
+//	    auth:
+//	      type: bearer
+//	      token: xxx
+//	  - repo_key: "team-a.#"
+//	    routes:
+//	      - pattern: team-a.mobile.*
+//	        target_urls: [https://mobile-ci.example.com/github-webhook/]
+//	      - pattern: "team-a.#"
+//	        target_url: https://team-a-ci.example.com/github-webhook/
+type relayFile struct {
+	Relays []relayFileEntry `yaml:"relays"`
+}
+
+// relayFileEntry describes one relay. Settings missing here fall back to the environment
+// variables for the relay's position (1-based), as with RELAY_COUNT.
+type relayFileEntry struct {
+	RepoKey       string            `yaml:"repo_key"`
+	RepoKeys      []string          `yaml:"repo_keys"`   // extra routing keys bound to the same queue (RELAY_REPO_KEYS)
+	TargetURL     string            `yaml:"target_url"`  // comma-separated like RELAY_TARGET_URL
+	TargetURLs    []string          `yaml:"target_urls"` // alternative to target_url
+	Timeout       int               `yaml:"timeout"`     // seconds
+	WebhookSecret string            `yaml:"webhook_secret"`
+	ForwardFormat string            `yaml:"forward_format"`
+	Headers       map[string]string `yaml:"headers"`
+	Auth          *relayFileAuth    `yaml:"auth"`
+	Routes        []relayFileRoute  `yaml:"routes"`  // replaces RELAY_ROUTES_<n>
+	Enabled       *bool             `yaml:"enabled"` // false keeps the relay configured without starting it (RELAY_ENABLED)
+}
+
+type relayFileRoute struct {
+	Pattern    string   `yaml:"pattern"`
+	TargetURL  string   `yaml:"target_url"`
+	TargetURLs []string `yaml:"target_urls"`
+}
+
+type relayFileAuth struct {
+	Type  string `yaml:"type"`
+	User  string `yaml:"user"`
+	Pass  string `yaml:"pass"`
+	Token string `yaml:"token"`
+}
+
+// loadRelayConfigFile parses RELAY_CONFIG_FILE into relay configurations.
+// Parse errors include the offending line reported by the YAML parser.
+func loadRelayConfigFile(path string) ([]RelayConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file relayFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true) // 오타난 키를 조용히 무시하지 않도록
+	if err := decoder.Decode(&file); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: file is empty", path)
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// 비밀 값은 파일에 적지 않고 ${NAME}으로 환경 변수에서 가져온다. 없는 변수는 모두 모아 한 번에 알려준다.
+	var errs []error
+	for i := range file.Relays {
+		if err := file.Relays[i].expandEnv(); err != nil {
+			errs = append(errs, fmt.Errorf("relays[%d]: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", path, errors.Join(errs...))
+	}
+
+	configs := make([]RelayConfig, 0, len(file.Relays))
+	for i, entry := range file.Relays {
+		configs = append(configs, entry.toRelayConfig(i+1))
+	}
+	return configs, nil
+}
+
+// envRefPattern matches a ${NAME} reference in a config file value
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvRefs replaces every ${NAME} in str with the environment variable NAME.
+// Unset variables are an error (set but empty is allowed). The error names the variables, never values.
+func expandEnvRefs(str string) (string, error) {
+	var missing []string
+	expanded := envRefPattern.ReplaceAllStringFunc(str, func(ref string) string {
+		name := envRefPattern.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// expandEnv applies expandEnvRefs to every string value of the entry
+func (e *relayFileEntry) expandEnv() error {
+	var errs []error
+	expand := func(field string, value *string) {
+		expanded, err := expandEnvRefs(*value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			return
+		}
+		*value = expanded
+	}
+
+	expand("repo_key", &e.RepoKey)
+	for i := range e.RepoKeys {
+		expand(fmt.Sprintf("repo_keys[%d]", i), &e.RepoKeys[i])
+	}
+	expand("target_url", &e.TargetURL)
+	for i := range e.TargetURLs {
+		expand(fmt.Sprintf("target_urls[%d]", i), &e.TargetURLs[i])
+	}
+	expand("webhook_secret", &e.WebhookSecret)
+	expand("forward_format", &e.ForwardFormat)
+	names := make([]string, 0, len(e.Headers))
+	for name := range e.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := e.Headers[name]
+		expand("headers."+name, &value)
+		e.Headers[name] = value
+	}
+	if e.Auth != nil {
+		expand("auth.type", &e.Auth.Type)
+		expand("auth.user", &e.Auth.User)
+		expand("auth.pass", &e.Auth.Pass)
+		expand("auth.token", &e.Auth.Token)
+	}
+	for i := range e.Routes {
+		route := &e.Routes[i]
+		expand(fmt.Sprintf("routes[%d].pattern", i), &route.Pattern)
+		expand(fmt.Sprintf("routes[%d].target_url", i), &route.TargetURL)
+		for j := range route.TargetURLs {
+			expand(fmt.Sprintf("routes[%d].target_urls[%d]", i, j), &route.TargetURLs[j])
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// toRelayConfig builds the relay configuration, overriding environment defaults with the file values
+func (e relayFileEntry) toRelayConfig(index int) RelayConfig {
+	targetURL := strings.Join(append([]string{e.TargetURL}, e.TargetURLs...), ",")
+	repoKey := e.RepoKey
+	if repoKey == "" && len(e.RepoKeys) > 0 {
+		repoKey = e.RepoKeys[0]
+	}
+	config := newRelayConfig(index, repoKey, targetURL)
+	if len(e.RepoKeys) > 0 {
+		config.BindKeys = bindKeys(repoKey, e.RepoKeys)
+	}
+
+	if e.Enabled != nil {
+		config.Enabled = *e.Enabled
+	}
+	if e.Timeout > 0 {
+		config.TimeoutSeconds = e.Timeout
+	}
+	if e.WebhookSecret != "" {
+		config.WebhookSecret = e.WebhookSecret
+	}
+	if e.ForwardFormat != "" {
+		config.ForwardFormat = normalizeForwardFormat(e.ForwardFormat)
+	}
+	for name, value := range e.Headers {
+		config.Headers[http.CanonicalHeaderKey(name)] = value
+	}
+	if len(e.Routes) > 0 {
+		config.Routes = nil
+		config.routesErr = nil
+		for _, r := range e.Routes {
+			route, err := newTargetRoute(r.Pattern, splitList(strings.Join(append([]string{r.TargetURL}, r.TargetURLs...), ",")))
+			if err != nil {
+				config.routesErr = err
+				break
+			}
+			config.Routes = append(config.Routes, route)
+		}
+	}
+	if e.Auth != nil {
+		config.AuthType, config.authTypeErr = parseAuthType(e.Auth.Type)
+		config.AuthUser = e.Auth.User
+		config.AuthPass = e.Auth.Pass
+		config.AuthToken = e.Auth.Token
+	}
+	return config
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// deadLetterReasonHeader carries the last forwarding error on dead-lettered messages
+const deadLetterReasonHeader = "x-relay-failure-reason"
+
+// deadLetterConfirmTimeout bounds how long to wait for the broker to confirm a dead-letter publish
+const deadLetterConfirmTimeout = 10 * time.Second
+
+// redeliveryTracker counts failed POSTs per message while MANUAL_ACK requeues them.
+// 브로커가 다시 보낸 메시지는 delivery tag가 바뀌므로 메시지 내용으로 식별한다.
+// The counts live only as long as the connection; a reconnect starts counting again.
+type redeliveryTracker struct {
+	failures map[string]int
+}
+
+func newRedeliveryTracker() *redeliveryTracker {
+	return &redeliveryTracker{failures: map[string]int{}}
+}
+
+// Failed records a failed attempt and returns the number of failures so far,
+// including deaths the broker recorded in the x-death header.
+func (t *redeliveryTracker) Failed(d amqp.Delivery) int {
+	key := deliveryKey(d)
+	t.failures[key]++
+	if deaths := xDeathCount(d); deaths+1 > t.failures[key] {
+		t.failures[key] = deaths + 1
+	}
+	return t.failures[key]
+}
+
+// Forget drops the counter once the message was acked
+func (t *redeliveryTracker) Forget(d amqp.Delivery) {
+	delete(t.failures, deliveryKey(d))
+}
+
+// deliveryKey identifies a message across redeliveries:
+// X-GitHub-Delivery header > AMQP message id > hash of the body.
+func deliveryKey(d amqp.Delivery) string {
+	if id := deliveryHeader(d, "X-GitHub-Delivery"); id != "" {
+		return id
+	}
+	if d.MessageId != "" {
+		return d.MessageId
+	}
+	sum := sha256.Sum256(d.Body)
+	return hex.EncodeToString(sum[:])
+}
+
+// xDeathCount sums the counts RabbitMQ recorded in the x-death header
+func xDeathCount(d amqp.Delivery) int {
+	deaths, ok := d.Headers["x-death"].([]interface{})
+	if !ok {
+		return 0
+	}
+
+	total := 0
+	for _, death := range deaths {
+		table, ok := death.(amqp.Table)
+		if !ok {
+			continue
+		}
+		if count, ok := table["count"].(int64); ok {
+			total += int(count)
+		}
+	}
+	return total
+}
+
+// publishDeadLetter republishes the message to the dead-letter exchange (RMQ_DLX_NAME)
+// with the original routing key and the failure reason in a header.
+// The channel is in confirm mode; this waits until the broker acks the publish.
+func publishDeadLetter(ch brokerChannel, exchange string, d amqp.Delivery, reason error) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[deadLetterReasonHeader] = reason.Error()
+
+	// 종료 중에도 확인을 받을 수 있도록 ctx 대신 별도 타임아웃 사용
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterConfirmTimeout)
+	defer cancel()
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, d.RoutingKey, false, false, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Body:            d.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("wait for publisher confirm: %w", err)
+	}
+	if !acked {
+		return errors.New("broker nacked the dead-letter publish")
+	}
+	return nil
+}
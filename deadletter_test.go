@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestConsumeRelayDeadLetters(t *testing.T) {
+	tests := []struct {
+		name        string
+		publishErr  error
+		confirm     fakeConfirmation
+		oversize    bool
+		wantOutcome string
+	}{
+		{name: "confirmed publish acks the original", wantOutcome: "ack"},
+		{name: "nacked publish requeues the original", confirm: fakeConfirmation{nacked: true}, wantOutcome: "requeue"},
+		{name: "unconfirmed publish requeues the original", confirm: fakeConfirmation{err: context.DeadlineExceeded}, wantOutcome: "requeue"},
+		{name: "failed publish requeues the original", publishErr: amqp.ErrClosed, wantOutcome: "requeue"},
+		{name: "oversized message is dead-lettered without forwarding", oversize: true, wantOutcome: "ack"},
+		{name: "oversized message stays queued when the publish is nacked", oversize: true, confirm: fakeConfirmation{nacked: true}, wantOutcome: "requeue"},
+		{name: "oversized message stays queued when the publish fails", oversize: true, publishErr: amqp.ErrClosed, wantOutcome: "requeue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MANUAL_ACK", "1")
+			t.Setenv("RMQ_DLX_NAME", "github-dlx")
+			t.Setenv("RMQ_MAX_REDELIVERIES", "1")
+			config := testRelayConfig("http://ci.example.com/github-webhook/")
+			config.PostMaxRetries = 0
+			if tt.oversize {
+				config.MaxPayloadBytes = 8
+			}
+			client := &fakeDoer{statuses: []int{500}}
+
+			// 브로커가 이미 한 번 dead-letter 했으므로 이번 실패로 RMQ_MAX_REDELIVERIES를 넘는다.
+			// 너무 큰 메시지는 전달하지 않고 바로 dead-letter 하므로 처음 받은 메시지로 둔다.
+			acks := newFakeAcknowledger()
+			d := acks.delivery(1, `{"ref":"refs/heads/main"}`)
+			if !tt.oversize {
+				d.Headers["x-death"] = []interface{}{amqp.Table{"count": int64(1)}}
+			}
+			ch := newFakeChannel(d)
+			ch.publishErr, ch.confirm = tt.publishErr, tt.confirm
+			close(ch.deliveries)
+
+			if err := consume(t, ch, config, client); err == nil {
+				t.Fatal("consumeRelay returned nil after the delivery channel closed")
+			}
+			if got := acks.Outcome(1); got != tt.wantOutcome {
+				t.Errorf("original settled with %q, want %q", got, tt.wantOutcome)
+			}
+			if tt.oversize && len(client.Requests()) > 0 {
+				t.Errorf("oversized message was forwarded")
+			}
+
+			calls := ch.Calls()
+			if len(calls) == 0 || calls[0] != "Confirm false" {
+				t.Errorf("channel calls = %q, want confirm mode set first", calls)
+			}
+			publish := slices.Index(calls, "Publish github-dlx MyOrg.my-repo")
+			if publish < 0 {
+				t.Fatalf("channel calls = %q, want a publish to the dead-letter exchange", calls)
+			}
+			if tt.publishErr == nil && (publish+1 >= len(calls) || calls[publish+1] != "WaitContext") {
+				t.Errorf("channel calls = %q, want the publisher confirm awaited right after the publish", calls)
+			}
+			if tt.publishErr == nil {
+				published := ch.Published()[0]
+				if string(published.Body) != string(d.Body) || published.DeliveryMode != amqp.Persistent {
+					t.Errorf("dead-letter message = %+v, want the original body, persistent", published)
+				}
+				if reason, _ := published.Headers[deadLetterReasonHeader].(string); reason == "" {
+					t.Errorf("dead-letter message has no %s header", deadLetterReasonHeader)
+				}
+			}
+		})
+	}
+}
+
+func TestConsumeRelayOversizeDeadLetterFailureIsBounded(t *testing.T) {
+	t.Setenv("MANUAL_ACK", "1")
+	t.Setenv("RMQ_DLX_NAME", "github-dlx")
+	t.Setenv("RMQ_MAX_REDELIVERIES", "2")
+	config := testRelayConfig("http://ci.example.com/github-webhook/")
+	config.MaxPayloadBytes = 8
+	client := &fakeDoer{}
+
+	// 없는 DLX처럼 매번 publish가 실패해도 같은 메시지를 끝없이 다시 받지 않는다.
+	acks := newFakeAcknowledger()
+	var redelivered []amqp.Delivery
+	for tag := uint64(1); tag <= 4; tag++ {
+		d := acks.delivery(tag, `{"ref":"refs/heads/main"}`)
+		d.Headers["X-GitHub-Delivery"] = "delivery-oversized"
+		redelivered = append(redelivered, d)
+	}
+	ch := newFakeChannel(redelivered...)
+	ch.publishErr = amqp.ErrClosed
+	close(ch.deliveries)
+
+	if err := consume(t, ch, config, client); err == nil {
+		t.Fatal("consumeRelay returned nil after the delivery channel closed")
+	}
+	// 세 번째 실패로 RMQ_MAX_REDELIVERIES를 넘어 버리고, 카운터가 지워져 다음 메시지는 다시 처음부터 센다.
+	for tag, want := range map[uint64]string{1: "requeue", 2: "requeue", 3: "ack", 4: "requeue"} {
+		if got := acks.Outcome(tag); got != want {
+			t.Errorf("delivery %d settled with %q, want %q", tag, got, want)
+		}
+	}
+	if len(client.Requests()) > 0 {
+		t.Errorf("oversized message was forwarded")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"container/list"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Deduplication defaults (RELAY_DEDUP_TTL_SECONDS, RELAY_DEDUP_SIZE)
+const (
+	defaultDedupTTLSeconds = 0 // disabled
+	defaultDedupSize       = 1000
+)
+
+// dedupCache remembers recently forwarded messages so a redelivery within TTL is skipped.
+// 연결이 끊겼다 붙으면서 브로커가 다시 보낸 메시지로 빌드가 두 번 돌지 않도록 한다.
+// Each relay owns its cache and keeps it across reconnects; entries are keyed by deliveryKey.
+type dedupCache struct {
+	ttl     time.Duration
+	size    int
+	order   *list.List // front = most recently forwarded
+	entries map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+// newDedupCache returns nil (deduplication disabled) when ttl is zero
+func newDedupCache(ttl time.Duration, size int) *dedupCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &dedupCache{ttl: ttl, size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Seen reports whether the message was forwarded within the TTL
+func (c *dedupCache) Seen(d amqp.Delivery) bool {
+	if c == nil {
+		return false
+	}
+	element, ok := c.entries[deliveryKey(d)]
+	if !ok {
+		return false
+	}
+	if time.Since(element.Value.(*dedupEntry).seenAt) > c.ttl {
+		c.remove(element)
+		return false
+	}
+	return true
+}
+
+// Remember records a forwarded message, evicting the least recently forwarded one when full.
+// 전달에 성공한 뒤에만 기록해야 실패 후 재전달된 메시지를 중복으로 버리지 않는다.
+func (c *dedupCache) Remember(d amqp.Delivery) {
+	if c == nil {
+		return
+	}
+	key := deliveryKey(d)
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*dedupEntry).seenAt = time.Now()
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&dedupEntry{key: key, seenAt: time.Now()})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *dedupCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*dedupEntry).key)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultGitHubEvent is forwarded when the message carries no event information.
+// Jenkins는 이 헤더가 없으면 웹훅을 무시한다.
+const defaultGitHubEvent = "push"
+
+// deliveryHeader returns the string value of an AMQP message header set by github-org-webhook-center.
+// Header names are matched case-insensitively since HTTP header casing is not preserved reliably.
+func deliveryHeader(d amqp.Delivery, name string) string {
+	value, ok := d.Headers[name]
+	if !ok {
+		for k, v := range d.Headers {
+			if strings.EqualFold(k, name) {
+				value, ok = v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return ""
+	}
+
+	str, _ := headerString(value)
+	return str
+}
+
+// headerString converts an AMQP header value holding text to a string.
+// Multiple values (an AMQP array) are joined like repeated HTTP headers.
+func headerString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := headerString(item); ok {
+				values = append(values, str)
+			}
+		}
+		return strings.Join(values, ", "), len(values) > 0
+	default:
+		return "", false
+	}
+}
+
+// githubHeaders returns the original X-GitHub-* and X-Hub-* request headers stored on the message,
+// keyed by their canonical HTTP names. Values of other types are skipped.
+func githubHeaders(d amqp.Delivery) map[string]string {
+	headers := map[string]string{}
+	for name, value := range d.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if !strings.HasPrefix(name, "X-Github-") && !strings.HasPrefix(name, "X-Hub-") {
+			continue
+		}
+		if str, ok := headerString(value); ok {
+			headers[name] = str
+		}
+	}
+	return headers
+}
+
+// deliveryID returns the original X-GitHub-Delivery of the message, or a new random UUID if absent
+func deliveryID(d amqp.Delivery) string {
+	if id := deliveryHeader(d, "X-GitHub-Delivery"); id != "" {
+		return id
+	}
+	return newUUID()
+}
+
+// eventType returns the X-GitHub-Event to forward for the delivery.
+// Precedence: X-GitHub-Event message header > event detected from the payload keys >
+// GITHUB_EVENT_MAP entry for the routing key > "push".
+func eventType(d amqp.Delivery, config RelayConfig) string {
+	if event := deliveryHeader(d, "X-GitHub-Event"); event != "" {
+		return event
+	}
+	if event := eventFromPayload(d.Body); event != "" {
+		return event
+	}
+	if event, ok := config.EventMap[d.RoutingKey]; ok {
+		return event
+	}
+	return defaultGitHubEvent
+}
+
+// eventFromPayload guesses the GitHub event type from the top-level keys of a JSON payload.
+// Returns "" when the payload is not JSON or matches no known event.
+// 더 구체적인 이벤트(예: issue_comment)를 먼저 검사해야 한다.
+func eventFromPayload(body []byte) string {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	has := func(key string) bool {
+		_, ok := payload[key]
+		return ok
+	}
+
+	switch {
+	case has("zen") && has("hook_id"):
+		return "ping"
+	case has("workflow_run"):
+		return "workflow_run"
+	case has("workflow_job"):
+		return "workflow_job"
+	case has("check_run"):
+		return "check_run"
+	case has("check_suite"):
+		return "check_suite"
+	case has("pull_request") && has("review"):
+		return "pull_request_review"
+	case has("pull_request") && has("comment"):
+		return "pull_request_review_comment"
+	case has("pull_request"):
+		return "pull_request"
+	case has("issue") && has("comment"):
+		return "issue_comment"
+	case has("issue"):
+		return "issues"
+	case has("release"):
+		return "release"
+	case has("deployment_status"):
+		return "deployment_status"
+	case has("deployment"):
+		return "deployment"
+	case has("forkee"):
+		return "fork"
+	case has("ref_type") && has("master_branch"):
+		return "create"
+	case has("ref_type"):
+		return "delete"
+	case has("ref") && has("before") && has("after"):
+		return "push"
+	}
+	return ""
+}
+
+// parseEventMap parses "routing_key=event,routing_key2=event2" into a map
+func parseEventMap(str string) (map[string]string, error) {
+	eventMap := map[string]string{}
+	for _, entry := range strings.Split(str, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, event, ok := strings.Cut(entry, "=")
+		key, event = strings.TrimSpace(key), strings.TrimSpace(event)
+		if !ok || key == "" || event == "" {
+			return nil, fmt.Errorf("invalid entry %q (expected routing_key=event)", entry)
+		}
+		eventMap[key] = event
+	}
+	return eventMap, nil
+}
+
+// newUUID generates a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
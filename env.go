@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// relayEnv returns the per-relay value NAME_<index> if set, otherwise the global NAME.
+// The legacy configuration (index 0) only reads the global NAME.
+func relayEnv(name string, index int) string {
+	if index > 0 {
+		if v := os.Getenv(fmt.Sprintf("%s_%d", name, index)); v != "" {
+			return v
+		}
+	}
+	return os.Getenv(name)
+}
+
+// relayOwnEnv returns NAME_<index> without falling back to the global NAME,
+// for settings that must not be shared between relays (the legacy configuration reads NAME).
+func relayOwnEnv(name string, index int) string {
+	if index > 0 {
+		return os.Getenv(fmt.Sprintf("%s_%d", name, index))
+	}
+	return os.Getenv(name)
+}
+
+// secretEnv returns the contents of the file named by NAME_FILE when set (Docker/Kubernetes secrets
+// mounted as files), otherwise NAME. Trailing newlines of the file are trimmed.
+func secretEnv(name string) string {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		// 파일을 못 읽으면 비밀 값 없이 조용히 동작하지 않도록 오류로 남긴다.
+		slog.Error("Reading secret file failed. Using the plain variable.", "name", name+"_FILE", "error", err)
+		return os.Getenv(name)
+	}
+	return strings.TrimRight(string(b), "\r\n")
+}
+
+// relaySecretEnv is relayEnv for secrets: NAME_<index>_FILE, NAME_<index>, then NAME_FILE, NAME
+func relaySecretEnv(name string, index int) string {
+	if index > 0 {
+		if v := secretEnv(fmt.Sprintf("%s_%d", name, index)); v != "" {
+			return v
+		}
+	}
+	return secretEnv(name)
+}
+
+// relayOwnSecretEnv is relayOwnEnv for secrets (NAME_<index>_FILE, then NAME_<index>)
+func relayOwnSecretEnv(name string, index int) string {
+	if index > 0 {
+		return secretEnv(fmt.Sprintf("%s_%d", name, index))
+	}
+	return secretEnv(name)
+}
+
+// relayEnvPositiveInt parses relayEnv(name, index) as a positive integer.
+// Falls back to defaultValue with a warning when the value is missing or invalid.
+func relayEnvPositiveInt(name string, index int, defaultValue int) int {
+	return parsePositiveInt(name, relayEnv(name, index), defaultValue)
+}
+
+// relayEnvNonNegativeInt parses relayEnv(name, index) as an integer >= 0
+func relayEnvNonNegativeInt(name string, index int, defaultValue int) int {
+	return parseNonNegativeInt(name, relayEnv(name, index), defaultValue)
+}
+
+// envNonNegativeInt parses the global environment variable name as an integer >= 0
+func envNonNegativeInt(name string, defaultValue int) int {
+	return parseNonNegativeInt(name, os.Getenv(name), defaultValue)
+}
+
+func parseNonNegativeInt(name string, str string, defaultValue int) int {
+	if str == "" {
+		return defaultValue
+	}
+
+	v, err := strconv.Atoi(str)
+	if err != nil || v < 0 {
+		slog.Warn("Invalid value. Using default.", "name", name, "value", str, "default", defaultValue)
+		return defaultValue
+	}
+	return v
+}
+
+// envPositiveInt parses the global environment variable name as a positive integer
+func envPositiveInt(name string, defaultValue int) int {
+	return parsePositiveInt(name, os.Getenv(name), defaultValue)
+}
+
+// relayEnvNonNegativeFloat parses relayEnv(name, index) as a float >= 0
+func relayEnvNonNegativeFloat(name string, index int, defaultValue float64) float64 {
+	str := relayEnv(name, index)
+	if str == "" {
+		return defaultValue
+	}
+
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil || v < 0 {
+		slog.Warn("Invalid value. Using default.", "name", name, "value", str, "default", defaultValue)
+		return defaultValue
+	}
+	return v
+}
+
+// envPositiveFloat parses the global environment variable name as a positive float
+func envPositiveFloat(name string, defaultValue float64) float64 {
+	str := os.Getenv(name)
+	if str == "" {
+		return defaultValue
+	}
+
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil || v <= 0 {
+		slog.Warn("Invalid value. Using default.", "name", name, "value", str, "default", defaultValue)
+		return defaultValue
+	}
+	return v
+}
+
+func parsePositiveInt(name string, str string, defaultValue int) int {
+	if str == "" {
+		return defaultValue
+	}
+
+	v, err := strconv.Atoi(str)
+	if err != nil || v <= 0 {
+		slog.Warn("Invalid value. Using default.", "name", name, "value", str, "default", defaultValue)
+		return defaultValue
+	}
+	return v
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Supported RMQ_EXCHANGE_TYPE values.
+// 익스체인지는 github-org-webhook-center가 선언하므로 릴레이는 바인딩 방식만 알면 된다.
+const (
+	exchangeTypeDirect = "direct" // repo key is matched exactly
+	exchangeTypeTopic  = "topic"  // repo key is a binding pattern (`*` = one word, `#` = zero or more words)
+)
+
+// exchangeType returns the RMQ_EXCHANGE_TYPE of RMQ_EXCHANGE_NAME, "direct" unless set to "topic"
+func exchangeType() string {
+	if strings.EqualFold(os.Getenv("RMQ_EXCHANGE_TYPE"), exchangeTypeTopic) {
+		return exchangeTypeTopic
+	}
+	return exchangeTypeDirect
+}
+
+// warnInvalidExchangeType logs an RMQ_EXCHANGE_TYPE that is neither "direct" nor "topic"
+func warnInvalidExchangeType() {
+	value := os.Getenv("RMQ_EXCHANGE_TYPE")
+	if value != "" && !strings.EqualFold(value, exchangeType()) {
+		slog.Warn("Invalid RMQ_EXCHANGE_TYPE. Using default.", "value", value, "default", exchangeTypeDirect)
+	}
+}
+
+// validateRoutingKey checks that repoKey can be bound to an exchange of the given type.
+// Topic wildcards only work as whole dot-separated words; anywhere else the broker matches them literally.
+func validateRoutingKey(repoKey string, exType string) error {
+	if !strings.ContainsAny(repoKey, "*#") {
+		return nil
+	}
+	if exType != exchangeTypeTopic {
+		return fmt.Errorf("wildcards require RMQ_EXCHANGE_TYPE=topic")
+	}
+	for _, word := range strings.Split(repoKey, ".") {
+		if strings.ContainsAny(word, "*#") && word != "*" && word != "#" {
+			return fmt.Errorf("wildcard %q must be a whole dot-separated word", word)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// branchPattern matches a git ref against one RELAY_BRANCH_FILTER entry.
+// Entries are globs ("main", "release/*") or regular expressions prefixed with "re:".
+type branchPattern struct {
+	glob  string
+	regex *regexp.Regexp
+}
+
+// parseBranchFilter parses a comma-separated RELAY_BRANCH_FILTER value
+func parseBranchFilter(str string) ([]branchPattern, error) {
+	var patterns []branchPattern
+	for _, entry := range splitList(str) {
+		if expr, ok := strings.CutPrefix(entry, "re:"); ok {
+			regex, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+			}
+			patterns = append(patterns, branchPattern{regex: regex})
+			continue
+		}
+		if _, err := path.Match(entry, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", entry, err)
+		}
+		patterns = append(patterns, branchPattern{glob: entry})
+	}
+	return patterns, nil
+}
+
+// String returns the RELAY_BRANCH_FILTER entry the pattern was parsed from
+func (p branchPattern) String() string {
+	if p.regex != nil {
+		return "re:" + p.regex.String()
+	}
+	return p.glob
+}
+
+// Matches checks the pattern against the branch name (ref without "refs/heads/") and the full ref
+func (p branchPattern) Matches(ref string) bool {
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	for _, candidate := range []string{branch, ref} {
+		if p.regex != nil {
+			if p.regex.MatchString(candidate) {
+				return true
+			}
+		} else if ok, _ := path.Match(p.glob, candidate); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// payloadRef extracts the "ref" field of a push payload.
+// Returns false for payloads without a ref (non-push events) or that are not JSON.
+func payloadRef(body []byte) (string, bool) {
+	var payload struct {
+		Ref *string `json:"ref"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Ref == nil {
+		return "", false
+	}
+	return *payload.Ref, true
+}
+
+// AllowsRef reports whether the payload passes RELAY_BRANCH_FILTER.
+// Payloads without a ref always pass through.
+func (c RelayConfig) AllowsRef(body []byte) (string, bool) {
+	if len(c.BranchFilter) == 0 {
+		return "", true
+	}
+	ref, ok := payloadRef(body)
+	if !ok {
+		return "", true
+	}
+	for _, pattern := range c.BranchFilter {
+		if pattern.Matches(ref) {
+			return ref, true
+		}
+	}
+	return ref, false
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// relayState records the connection state of a single relay
+type relayState struct {
+	RepoKey           string
+	TargetHosts       []string
+	Connected         bool
+	Paused            bool      // consuming stopped by SIGUSR1 while staying connected
+	LastConnected     time.Time // last time a consumer was started
+	DisconnectedSince time.Time // start of the current disconnected period (zero while connected)
+	LastMessage       time.Time // last time a message was forwarded (or failed to be)
+	MessagesProcessed uint64
+	LastError         string // last forwarding or connection error
+}
+
+// relayStatus is one entry of the /status response
+type relayStatus struct {
+	Index             int        `json:"index"`
+	RepoKey           string     `json:"repo_key"`
+	TargetHosts       []string   `json:"target_hosts"`
+	Connected         bool       `json:"connected"`
+	Paused            bool       `json:"paused"`
+	LastMessage       *time.Time `json:"last_message"`
+	MessagesProcessed uint64     `json:"messages_processed"`
+	LastError         string     `json:"last_error"`
+	OpenCircuits      []string   `json:"open_circuits"` // target hosts failing fast (RELAY_CIRCUIT_THRESHOLD)
+}
+
+// relayStateRegistry is shared by all relay goroutines and the health server
+type relayStateRegistry struct {
+	mu     sync.Mutex
+	relays map[int]*relayState
+}
+
+var relayStates = &relayStateRegistry{relays: map[int]*relayState{}}
+
+// Register adds a relay in the disconnected state (before its first connection)
+func (r *relayStateRegistry) Register(config RelayConfig) {
+	hosts := make([]string, 0, len(config.TargetURLs))
+	for _, targetURL := range config.allTargetURLs() {
+		hosts = append(hosts, urlHost(targetURL))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.relays[config.Index] = &relayState{RepoKey: config.RepoKey, TargetHosts: hosts, DisconnectedSince: time.Now()}
+}
+
+// Unregister removes a relay stopped by a configuration reload
+func (r *relayStateRegistry) Unregister(index int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.relays, index)
+}
+
+// SetConnected marks the relay as consuming from its queue
+func (r *relayStateRegistry) SetConnected(index int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.get(index)
+	state.Connected = true
+	state.LastConnected = time.Now()
+	state.DisconnectedSince = time.Time{}
+}
+
+// SetDisconnected marks the relay as being in its reconnect loop
+func (r *relayStateRegistry) SetDisconnected(index int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.get(index)
+	if state.Connected || state.DisconnectedSince.IsZero() {
+		state.DisconnectedSince = time.Now()
+	}
+	state.Connected = false
+}
+
+// RecordMessage counts a forwarded message. err is the forwarding error, if any.
+func (r *relayStateRegistry) RecordMessage(index int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.get(index)
+	state.LastMessage = time.Now()
+	state.MessagesProcessed++
+	if err != nil {
+		state.LastError = err.Error()
+	}
+}
+
+// RecordError keeps err as the relay's last error (e.g. a lost connection)
+func (r *relayStateRegistry) RecordError(index int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(index).LastError = err.Error()
+}
+
+// Statuses returns a snapshot of every relay ordered by index
+func (r *relayStateRegistry) Statuses() []relayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := make([]relayStatus, 0, len(r.relays))
+	for index, state := range r.relays {
+		status := relayStatus{
+			Index:             index,
+			RepoKey:           state.RepoKey,
+			TargetHosts:       state.TargetHosts,
+			Connected:         state.Connected,
+			Paused:            state.Paused,
+			MessagesProcessed: state.MessagesProcessed,
+			LastError:         state.LastError,
+			OpenCircuits:      circuitBreakers.OpenTargets(index),
+		}
+		if !state.LastMessage.IsZero() {
+			lastMessage := state.LastMessage
+			status.LastMessage = &lastMessage
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Index < statuses[j].Index })
+	return statuses
+}
+
+// SetPaused records whether the relay stopped consuming because of SIGUSR1
+func (r *relayStateRegistry) SetPaused(index int, paused bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(index).Paused = paused
+}
+
+// ConnectedSince reports whether the relay started consuming at or after t
+func (r *relayStateRegistry) ConnectedSince(index int, t time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.get(index).LastConnected.Before(t)
+}
+
+// DisconnectedLongerThan returns the indices of relays disconnected for longer than threshold
+func (r *relayStateRegistry) DisconnectedLongerThan(threshold time.Duration) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var indices []int
+	for index, state := range r.relays {
+		if !state.Connected && time.Since(state.DisconnectedSince) > threshold {
+			indices = append(indices, index)
+		}
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// NotConsuming returns the indices of relays without an active consumer (starting up, reconnecting or paused by SIGUSR1)
+func (r *relayStateRegistry) NotConsuming() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var indices []int
+	for index, state := range r.relays {
+		// 일시 정지 중에는 연결은 유지하지만 메시지를 받지 않는다.
+		if !state.Connected || state.Paused {
+			indices = append(indices, index)
+		}
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+func (r *relayStateRegistry) get(index int) *relayState {
+	state, ok := r.relays[index]
+	if !ok {
+		state = &relayState{}
+		r.relays[index] = state
+	}
+	return state
+}
+
+// startHealthServer serves /healthz, /readyz, /status and /metrics on HEALTH_PORT (default 8080).
+// /healthz (liveness) returns 503 if any relay stayed disconnected longer than HEALTH_DISCONNECT_THRESHOLD_SECONDS.
+// /readyz (readiness) returns 503 unless every relay is consuming right now.
+// /status returns a JSON array describing every relay for operators.
+// /replay re-sends recent payloads, only when REPLAY_TOKEN is set (see replayStore).
+// /inject forwards a test payload, only when INJECT_TOKEN is set (see injectHandler).
+func startHealthServer() {
+	port := os.Getenv("HEALTH_PORT")
+	if port == "" {
+		port = "8080"
+	}
+	threshold := time.Duration(envPositiveInt("HEALTH_DISCONNECT_THRESHOLD_SECONDS", 300)) * time.Second
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if unhealthy := relayStates.DisconnectedLongerThan(threshold); len(unhealthy) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintf(w, "relays disconnected longer than %v: %v\n", threshold, unhealthy)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if notReady := relayStates.NotConsuming(); len(notReady) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintf(w, "relays not consuming: %v\n", notReady)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(relayStates.Statuses()); err != nil {
+			slog.Warn("Writing /status response failed", "error", err)
+		}
+	})
+	if replays != nil {
+		mux.Handle("/replay", replays)
+	}
+	if injector != nil {
+		mux.Handle("/inject", injector)
+	}
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		slog.Info("Health server listening", "port", port)
+		err := http.ListenAndServe(":"+port, mux)
+		if err != nil {
+			slog.Error("Health server stopped", "error", err)
+		}
+	}()
+}
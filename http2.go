@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// http2RoundTripper sends every request over HTTP/2 (RELAY_HTTP2=1): https targets negotiate h2 with TLS,
+// http and unix:// targets use h2c with prior knowledge (no upgrade, no fallback to HTTP/1.1).
+// 기본 transport도 TLS에서는 h2를 협상하지만, 평문 대상에는 HTTP/1.1만 쓰므로 h2c가 필요한 게이트웨이용이다.
+type http2RoundTripper struct {
+	h2  *http2.Transport // https
+	h2c *http2.Transport // http, unix://
+}
+
+// newHTTP2Transport builds the HTTP/2 round tripper. tlsConfig carries RELAY_TLS_* (nil = system defaults).
+// HTTP/2 transports do not support proxies, so RELAY_PROXY_URL / HTTP_PROXY_URL are not used.
+func newHTTP2Transport(tlsConfig *tls.Config) http.RoundTripper {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := dialUnixOrTCP(dialer, dialer.DialContext)
+	idleTimeout := time.Duration(envPositiveInt("HTTP_IDLE_CONN_TIMEOUT_SECONDS", 90)) * time.Second
+
+	return &http2RoundTripper{
+		h2: &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			IdleConnTimeout: idleTimeout,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dial(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, cfg)
+				if err := tlsConn.HandshakeContext(ctx); err != nil {
+					_ = conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
+			},
+		},
+		h2c: &http2.Transport{
+			AllowHTTP:       true,
+			IdleConnTimeout: idleTimeout,
+			// h2c: TLS 없이 평문 연결에서 바로 HTTP/2 프레임을 보낸다.
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		},
+	}
+}
+
+func (t *http2RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		return t.h2.RoundTrip(req)
+	}
+	return t.h2c.RoundTrip(req)
+}
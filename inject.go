@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// maxInjectBytes caps the JSON body accepted by /inject
+const maxInjectBytes = 1 << 20
+
+// injectHandler backs the /inject admin endpoint. It is nil unless INJECT_TOKEN is set.
+// 실제 푸시를 기다리지 않고 새로 설정한 대상의 연결과 인증을 끝까지 확인할 수 있게 한다.
+type injectHandler struct {
+	token  string
+	client httpDoer
+
+	mu      sync.Mutex
+	configs map[int]RelayConfig
+}
+
+var injector *injectHandler
+
+// newInjectHandler creates the handler, or returns nil when INJECT_TOKEN is not set. Relays are added with Register.
+func newInjectHandler(client httpDoer) *injectHandler {
+	token := secretEnv("INJECT_TOKEN")
+	if token == "" {
+		return nil
+	}
+	return &injectHandler{token: token, client: client, configs: map[int]RelayConfig{}}
+}
+
+// Register makes the relay available to /inject, replacing its previous configuration after a reload
+func (h *injectHandler) Register(config RelayConfig) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.configs[config.Index] = config
+}
+
+// Unregister removes a relay stopped by a configuration reload
+func (h *injectHandler) Unregister(index int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.configs, index)
+}
+
+// config returns the configuration of the relay at index
+func (h *injectHandler) config(index int) (RelayConfig, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	config, ok := h.configs[index]
+	return config, ok
+}
+
+type injectedKey struct{}
+
+// withInjected marks ctx as carrying a message injected through /inject, not consumed from the broker
+func withInjected(ctx context.Context) context.Context {
+	return context.WithValue(ctx, injectedKey{}, true)
+}
+
+// isInjected reports whether ctx carries an injected message. Injected POSTs are left out of the metrics.
+func isInjected(ctx context.Context) bool {
+	injected, _ := ctx.Value(injectedKey{}).(bool)
+	return injected
+}
+
+// ServeHTTP handles POST /inject?relay=<index>[&event=<type>][&routing_key=<key>] with a JSON body.
+// Requires "Authorization: Bearer <INJECT_TOKEN>". The body goes through postToUrl like a broker message
+// (format, template, headers, auth, signature), with the relay's repo key as the default routing key.
+func (h *injectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !bearerAuthorized(r, h.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	index, err := strconv.Atoi(r.URL.Query().Get("relay"))
+	if err != nil {
+		http.Error(w, "relay must be a relay index", http.StatusBadRequest)
+		return
+	}
+	config, ok := h.config(index)
+	if !ok {
+		http.Error(w, "unknown relay", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInjectBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "reading body failed", http.StatusBadRequest)
+		return
+	}
+	if !json.Valid(body) {
+		http.Error(w, "body must be a JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	d := amqp.Delivery{Body: body, RoutingKey: config.RepoKey, ContentType: "application/json"}
+	if key := r.URL.Query().Get("routing_key"); key != "" {
+		d.RoutingKey = key
+	}
+	if event := r.URL.Query().Get("event"); event != "" {
+		d.Headers = amqp.Table{"X-GitHub-Event": event}
+	}
+
+	// 브로커에서 온 메시지와 구분되도록 correlation_id에 접두사를 붙이고 지표에서는 뺀다.
+	correlationID := "inject-" + newCorrelationID()
+	logger := relayLogger(config).With("correlation_id", correlationID)
+	logger.Warn("Injecting a test message", "routing_key", d.RoutingKey, "payload_bytes", len(body), "remote_addr", r.RemoteAddr)
+
+	ctx, span := startDeliverySpan(withInjected(withCorrelationID(inFlightCtx, correlationID)), d, config)
+	result := postToUrl(ctx, h.client, d, config)
+	endSpan(span, result.Err)
+
+	response := adminPostResult{CorrelationID: correlationID, RoutingKey: d.RoutingKey, StatusCode: result.StatusCode, Attempts: result.Attempts}
+	if result.Err != nil {
+		response.Error = result.Err.Error()
+		logger.Error("Injected message failed", "error", result.Err, "duration", result.Duration.String())
+	} else {
+		logger.Info("Injected message forwarded", "status_code", result.StatusCode, "duration", result.Duration.String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Warn("Writing /inject response failed", "error", err)
+	}
+}
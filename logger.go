@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Payload logging settings, read by setupLogger
+var (
+	logPayload         bool // LOG_PAYLOAD=1 - dump forwarded payloads (at debug level)
+	logPayloadMaxBytes int  // LOG_PAYLOAD_MAX_BYTES - truncate dumped payloads (0 = no limit)
+)
+
+// setupLogger installs a JSON slog logger as the default, with the level taken from LOG_LEVEL
+// (debug, info, warn, error; default info). The standard log package is redirected to it as well.
+func setupLogger() {
+	var level slog.Level
+	levelStr := os.Getenv("LOG_LEVEL")
+	invalidLevel := false
+	if levelStr != "" {
+		if err := level.UnmarshalText([]byte(strings.ToUpper(levelStr))); err != nil {
+			level = slog.LevelInfo
+			invalidLevel = true
+		}
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	if invalidLevel {
+		slog.Warn("Invalid LOG_LEVEL value. Using info.", "value", levelStr)
+	}
+
+	// 페이로드에는 커밋 메시지나 토큰이 들어있을 수 있어 기본적으로 남기지 않는다.
+	logPayload = os.Getenv("LOG_PAYLOAD") == "1"
+	logPayloadMaxBytes = envNonNegativeInt("LOG_PAYLOAD_MAX_BYTES", 0)
+}
+
+// logForwardedPayload logs the payload size, and the payload itself when LOG_PAYLOAD=1
+func logForwardedPayload(logger *slog.Logger, body string) {
+	logger.Info("Forwarding payload", "payload_bytes", len(body))
+	if !logPayload {
+		return
+	}
+
+	truncated := false
+	if logPayloadMaxBytes > 0 && len(body) > logPayloadMaxBytes {
+		body = body[:logPayloadMaxBytes]
+		truncated = true
+	}
+	logger.Debug("Payload", "payload", body, "truncated", truncated)
+}
+
+// relayLogger returns a logger carrying the fields that identify the relay on every line.
+// Per-target lines add their own target_url field.
+func relayLogger(config RelayConfig) *slog.Logger {
+	logger := slog.With(
+		"relay_index", config.Index,
+		"repo_key", config.RepoKey,
+	)
+	if len(config.BindKeys) > 1 {
+		logger = logger.With("repo_keys", config.BindKeys)
+	}
+	return logger
+}
+
+// correlationKey is the context key of the correlation ID of the message being processed
+type correlationKey struct{}
+
+// newCorrelationID returns a short random ID identifying one delivery in the logs
+func newCorrelationID() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// withCorrelationID attaches the message's correlation ID to ctx
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// messageLogger returns relayLogger(config) with the correlation_id carried by ctx, if any
+func messageLogger(ctx context.Context, config RelayConfig) *slog.Logger {
+	logger := relayLogger(config)
+	if id, ok := ctx.Value(correlationKey{}).(string); ok {
+		logger = logger.With("correlation_id", id)
+	}
+	return logger
+}
+
+// redactURL masks the password and query values of a URL for logging
+// (target URLs may carry credentials such as user:pass@ or ?token=).
+func redactURL(str string) string {
+	u, err := url.Parse(str)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	if query := u.Query(); len(query) > 0 {
+		for name := range query {
+			query.Set(name, "xxxxx")
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// redactURLs applies redactURL to every URL
+func redactURLs(urls []string) []string {
+	redacted := make([]string, 0, len(urls))
+	for _, u := range urls {
+		redacted = append(redacted, redactURL(u))
+	}
+	return redacted
+}
+
+// urlHost returns only the host[:port] of a URL, or "" if it cannot be parsed
+func urlHost(str string) string {
+	u, err := url.Parse(str)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// relaySummary is the per-relay part of the startup configuration log
+type relaySummary struct {
+	Index          int      `json:"index"`
+	Disabled       bool     `json:"disabled,omitempty"`
+	RepoKey        string   `json:"repo_key"`
+	RepoKeys       []string `json:"repo_keys,omitempty"`
+	BrokerHost     string   `json:"broker_host"`
+	Exchange       string   `json:"exchange"`
+	TargetHosts    []string `json:"target_hosts"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+	Auth           string   `json:"auth"`
+	Signed         bool     `json:"signed"`
+	SignHeader     string   `json:"sign_header,omitempty"`
+	TargetToken    bool     `json:"target_token"`
+}
+
+// logEffectiveConfig logs the effective configuration in a single line for support tickets.
+// 비밀번호, 토큰, 시크릿과 전체 URL은 남기지 않는다.
+func logEffectiveConfig(configs []RelayConfig) {
+	relays := make([]relaySummary, 0, len(configs))
+	for _, config := range configs {
+		hosts := make([]string, 0, len(config.TargetURLs))
+		for _, targetURL := range config.allTargetURLs() {
+			hosts = append(hosts, urlHost(targetURL))
+		}
+		var extraKeys []string
+		if len(config.BindKeys) > 1 {
+			extraKeys = config.BindKeys[1:]
+		}
+		relays = append(relays, relaySummary{
+			Index:          config.Index,
+			Disabled:       !config.Enabled,
+			RepoKey:        config.RepoKey,
+			RepoKeys:       extraKeys,
+			BrokerHost:     urlHost(config.BrokerAddr),
+			Exchange:       config.Exchange,
+			TargetHosts:    hosts,
+			TimeoutSeconds: config.TimeoutSeconds,
+			Auth:           config.AuthType,
+			Signed:         config.WebhookSecret != "",
+			SignHeader:     config.SignHeader,
+			TargetToken:    config.TargetToken != "",
+		})
+	}
+
+	slog.Info("Effective configuration",
+		"broker_host", urlHost(secretEnv("RMQ_ADDR_ROOT")),
+		"exchange", os.Getenv("RMQ_EXCHANGE_NAME"),
+		"exchange_type", exchangeType(),
+		"manual_ack", os.Getenv("MANUAL_ACK") == "1",
+		"relays", relays,
+	)
+}
@@ -2,149 +2,710 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/joho/godotenv"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 )
 
-var shutdownCh chan string
+// requestShutdown stops every relay, the same way SIGTERM does.
+// 한 릴레이에서 호출해도 모든 릴레이의 ctx가 취소된다 (broadcast).
+var requestShutdown context.CancelCauseFunc
+
+// inFlightCtx carries every POST, including spool retries. Unlike the shutdown ctx it is only
+// cancelled when SHUTDOWN_GRACE_SECONDS runs out, so requests already started can finish.
+var inFlightCtx = context.Background()
+
+// errAllRelaysGaveUp is the shutdown cause when every relay hit RMQ_MAX_RECONNECT_ATTEMPTS
+var errAllRelaysGaveUp = errors.New("all relays gave up reconnecting")
+
+// errConsumerCancelled is returned by consumeRelay when the broker cancelled the consumer, so the relay reconnects
+var errConsumerCancelled = errors.New("consumer cancelled by the broker")
 
 // RelayConfig represents a single relay configuration pair
 type RelayConfig struct {
-	RepoKey   string // DIRECT_EXCHANGE_REPO_KEY - RabbitMQ routing key
-	TargetURL string // RELAY_TARGET_URL - destination URL for webhook
-	Index     int    // Configuration index for logging
+	Enabled    bool          // RELAY_ENABLED_<n> - "0" keeps the relay configured but does not start it (default enabled)
+	RepoKey    string        // DIRECT_EXCHANGE_REPO_KEY - RabbitMQ routing key (binding pattern with RMQ_EXCHANGE_TYPE=topic), the primary key
+	BindKeys   []string      // RepoKey followed by RELAY_REPO_KEYS - every routing key bound to the relay's queue
+	TargetURLs []string      // RELAY_TARGET_URL - comma-separated destination URLs, each gets every webhook (fan-out)
+	Routes     []targetRoute // RELAY_ROUTES - routing key patterns picking the targets per message (first match wins, else TargetURLs)
+	LBMode     string        // RELAY_LB_MODE - "fanout" (default) or "roundrobin" across TargetURLs
+	Index      int           // Configuration index for logging
+	BrokerAddr string        // RMQ_ADDR_<n>, else RMQ_ADDR_ROOT - RabbitMQ address to consume from
+	Exchange   string        // RELAY_EXCHANGE_<n>, else RMQ_EXCHANGE_NAME - exchange the queue is bound to
+
+	Method         string // RELAY_METHOD - POST (default), PUT or GET (payload as query string)
+	TimeoutSeconds int    // HTTP_TIMEOUT_SECONDS - timeout for a single POST to a target
+	WebhookSecret  string // GITHUB_WEBHOOK_SECRET - signs the forwarded body as X-Hub-Signature-256 (empty = no signature)
+	SignHeader     string // RELAY_SIGN_HEADER - header carrying a custom signature of the body (empty = none)
+	SignSecret     string // RELAY_SIGN_SECRET - HMAC key of the custom signature
+	SignAlgo       string // RELAY_SIGN_ALGO - hmac-sha256 (default), hmac-sha512 or hmac-sha1
+
+	ForwardFormat string            // FORWARD_FORMAT - "form" (payload=<json>), "json" (raw body) or "multipart" (payload.json file part)
+	Gzip          bool              // RELAY_GZIP - gzip the request body (Content-Encoding: gzip)
+	FormField     string            // RELAY_FORM_FIELD - form field holding the JSON payload (default "payload")
+	EventMap      map[string]string // GITHUB_EVENT_MAP - routing key to X-GitHub-Event when the message has no event header
+	EventFilter   []string          // RELAY_EVENT_FILTER - event types to relay (empty = all)
+	BranchFilter  []branchPattern   // RELAY_BRANCH_FILTER - refs to relay for payloads with a "ref" (empty = all)
+
+	Template *template.Template // RELAY_TEMPLATE - reshapes the parsed JSON payload before encoding (nil = forward unchanged)
+
+	ForwardGitHubHeaders bool // RELAY_FORWARD_GITHUB_HEADERS - copy the original X-GitHub-*/X-Hub-* message headers to the request
+
+	HostHeader string // RELAY_HOST_HEADER - Host of forward requests (req.Host) for ingresses routing by Host (empty = URL host)
+
+	UserAgent string // RELAY_USER_AGENT - User-Agent of forward requests (default github-mq-to-post-relay/<version>)
+
+	Headers         map[string]string // RELAY_HEADERS - extra request headers ("k1:v1;k2:v2" or a JSON object)
+	HeadersOverride bool              // RELAY_HEADERS_OVERRIDE - let Headers replace reserved GitHub/content headers
+
+	TargetToken      string // RELAY_TARGET_TOKEN - secret appended to every target URL's query at request time (never logged)
+	TargetTokenParam string // RELAY_TARGET_TOKEN_PARAM - query parameter name for TargetToken (default "token")
+
+	QueryMap []queryMapping // RELAY_QUERY_MAP - query parameters taken from JSON paths of the payload (e.g. branch=$.ref)
+
+	AuthType  string // RELAY_AUTH_TYPE - "none", "basic" or "bearer"
+	AuthUser  string // RELAY_AUTH_USER - basic auth user
+	AuthPass  string // RELAY_AUTH_PASS - basic auth password (never logged)
+	AuthToken string // RELAY_AUTH_TOKEN - bearer token (never logged)
+
+	Prefetch int // RMQ_PREFETCH - max unacked messages the broker delivers to this relay at once
+
+	QueueName    string // RMQ_QUEUE_NAME_<n> - named queue instead of a server-named one
+	QueueDurable bool   // RMQ_QUEUE_DURABLE - declare QueueName durable and non-exclusive so it buffers messages while disconnected
+	QueueType    string // RELAY_QUEUE_TYPE - "classic" (default) or "quorum" (requires a durable named queue)
+	QueueTTLMs   int    // RELAY_QUEUE_TTL_MS - x-message-ttl of the durable queue, so stale triggers expire (0 = none)
+	QueueMaxLen  int    // RELAY_QUEUE_MAXLEN - x-max-length of the durable queue, oldest messages are dropped first (0 = none)
+
+	// ConsumerExclusive (RMQ_CONSUMER_EXCLUSIVE) consumes the queue as an exclusive consumer: while one instance
+	// consumes a durable named queue, the others get ACCESS_REFUSED and retry with the reconnect backoff (active/standby).
+	ConsumerExclusive bool
+
+	ProxyURL *url.URL // RELAY_PROXY_URL_<n>, else HTTP_PROXY_URL - outbound proxy (nil = HTTP_PROXY/HTTPS_PROXY environment)
+
+	// ShutdownOnPush (RELAY_SHUTDOWN_ON_PUSH_<n>, else SHUTDOWN_ON_GITHUB_PUSH) makes a message on this relay
+	// stop the whole process, not just this relay: every relay stops consuming and the process exits 0
+	// after in-flight POSTs finish (the same path as SIGTERM). Relays without it never trigger a shutdown.
+	ShutdownOnPush bool
+
+	DryRun bool // DRY_RUN / RELAY_DRY_RUN_<n> - log the POSTs instead of sending them
+
+	DedupTTLSeconds int // RELAY_DEDUP_TTL_SECONDS - skip messages already forwarded within this window (0 = off)
+	DedupSize       int // RELAY_DEDUP_SIZE - max remembered messages per relay
+
+	RateLimit float64 // RELAY_RATE_LIMIT - max POSTed messages per second (0 = unlimited)
+	RateBurst int     // RELAY_RATE_BURST - messages allowed at once above RateLimit
+
+	DelayMs int // RELAY_DELAY_MS - wait before forwarding so mirrors can catch up with the push (0 = no delay)
+
+	MaxMessageAgeSeconds int // MAX_MESSAGE_AGE_SECONDS - drop messages whose timestamp is older than this (0 = never)
+
+	MaxPayloadBytes int // MAX_PAYLOAD_BYTES - drop (or dead-letter) larger messages without forwarding them (0 = no limit)
+
+	BackpressureMode   string // BACKPRESSURE_MODE - "block" (default), "drop-oldest" or "drop-newest" while the relay is busy forwarding
+	BackpressureBuffer int    // BACKPRESSURE_BUFFER - messages waiting for the relay before the drop modes start dropping
+
+	PostMaxRetries     int // POST_MAX_RETRIES - extra attempts after a connection error or 5xx response
+	PostRetryBackoffMs int // POST_RETRY_BACKOFF_MS - delay before the first retry, doubled for each further retry
+
+	CircuitThreshold       int // RELAY_CIRCUIT_THRESHOLD - consecutive failures that open a target's circuit (0 = no circuit breaker)
+	CircuitCooldownSeconds int // RELAY_CIRCUIT_COOLDOWN_SECONDS - how long an open circuit fails fast before a probe request
+
+	SuccessCodes statusCodeSet // RELAY_SUCCESS_CODES - status codes counted as success, redirects among them are not followed (nil = 2xx)
+
+	rotation        *atomic.Uint64 // round-robin position, shared by the copies of this config
+	client          *http.Client   // dedicated client when RELAY_TLS_* is set (nil = shared client)
+	clientSettings  string         // RELAY_TLS_* / RELAY_HTTP2 values the client was built from, compared on reload
+	tlsErr          error          // loading RELAY_TLS_* failed, reported by validateRelayConfig
+	templateErr     error          // parsing RELAY_TEMPLATE failed, reported by validateRelayConfig
+	routesErr       error          // parsing RELAY_ROUTES failed, reported by validateRelayConfig
+	successCodesErr error          // parsing RELAY_SUCCESS_CODES failed, reported by validateRelayConfig
+	queryMapErr     error          // parsing RELAY_QUERY_MAP failed, reported by validateRelayConfig
+	branchFilterErr error          // parsing RELAY_BRANCH_FILTER failed, reported by validateRelayConfig
+	headersErr      error          // parsing RELAY_HEADERS failed, reported by validateRelayConfig
+	proxyErr        error          // parsing RELAY_PROXY_URL / HTTP_PROXY_URL failed, reported by validateRelayConfig
+	authTypeErr     error          // RELAY_AUTH_TYPE is not supported, reported by validateRelayConfig
 }
 
+const defaultHTTPTimeoutSeconds = 10
+
+const defaultPrefetch = 10
+
+// defaultMaxPayloadBytes is the largest message body forwarded (MAX_PAYLOAD_BYTES)
+const defaultMaxPayloadBytes = 10 << 20
+
+// defaultMaxRedeliveries is how many failed POSTs a MANUAL_ACK message gets before dead-lettering
+const defaultMaxRedeliveries = 5
+
+// Spool defaults (SPOOL_MAX_MB, SPOOL_RETRY_SECONDS)
+const (
+	defaultSpoolMaxMB        = 100
+	defaultSpoolRetrySeconds = 60
+)
+
+// AMQP connection defaults (RMQ_HEARTBEAT_SECONDS, RMQ_DIAL_TIMEOUT_SECONDS, RMQ_LOCALE), same as amqp091-go's
+const (
+	defaultHeartbeatSeconds   = 10
+	defaultDialTimeoutSeconds = 30
+	defaultAMQPLocale         = "en_US"
+)
+
+// defaultQueueDepthIntervalSeconds is how often named queues are inspected (RMQ_QUEUE_DEPTH_INTERVAL_SECONDS)
+const defaultQueueDepthIntervalSeconds = 30
+
+// defaultConsumerTagPrefix starts the consumer tag unless RMQ_CONSUMER_TAG_PREFIX is set
+const defaultConsumerTagPrefix = "github-relay"
+
+// defaultConnNameTemplate names the broker connections unless RMQ_CONN_NAME_TEMPLATE is set.
+// 호스트 이름이 있어야 HA로 여러 인스턴스를 띄웠을 때 관리 UI에서 구분할 수 있다.
+const defaultConnNameTemplate = "github-mq-to-post-relay:{{.RepoKey}}@{{.Host}}"
+
+// defaultShutdownGraceSeconds bounds how long in-flight POSTs may take after SIGTERM/SIGINT (SHUTDOWN_GRACE_SECONDS)
+const defaultShutdownGraceSeconds = 30
+
 // github-org-webhook-center에서 MQ로 넣어주느 메시지를 받아서 다른 URL로 POST한다.
 // github.com에서 웹훅은 하나만 지정해줄 수 있는데, 빌드 머신이 두 개 이상이라면 웹훅 하나에 두 개의 머신에 URL 불러줄 필요 있어서 만들었다.
 
-// loadRelayConfigs loads relay configurations from environment variables
+// loadRelayConfigs loads relay configurations from RELAY_CONFIG_FILE or environment variables
 // Supports both multi-relay (with RELAY_COUNT) and legacy single relay format
-func loadRelayConfigs() []RelayConfig {
-	var configs []RelayConfig
+// Invalid relays fail the whole load unless RELAY_ALLOW_PARTIAL=1
+func loadRelayConfigs() ([]RelayConfig, error) {
+	allowPartial := os.Getenv("RELAY_ALLOW_PARTIAL") == "1"
+	warnInvalidExchangeType()
+
+	if configFile := os.Getenv("RELAY_CONFIG_FILE"); configFile != "" {
+		candidates, err := loadRelayConfigFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading RELAY_CONFIG_FILE: %w", err)
+		}
+
+		slog.Info("Loading relay configurations from file...", "file", configFile, "count", len(candidates))
+		configs, err := checkRelayConfigs(candidates, nil, allowPartial)
+		if err != nil {
+			return nil, err
+		}
+		if len(configs) == 0 {
+			return nil, fmt.Errorf("no valid relay configurations found in RELAY_CONFIG_FILE %s", configFile)
+		}
+		return configs, nil
+	}
 
 	// Check for multi-relay configuration
 	relayCountStr := os.Getenv("RELAY_COUNT")
 	if relayCountStr != "" {
 		relayCount, err := strconv.Atoi(relayCountStr)
-		if err != nil {
-			log.Printf("Invalid RELAY_COUNT value: %s. Using legacy configuration.\n", relayCountStr)
+		if err != nil || relayCount <= 0 {
+			if !allowPartial {
+				return nil, reportConfigProblems([]string{fmt.Sprintf("invalid RELAY_COUNT value %q", relayCountStr)}, false)
+			}
+			slog.Warn("Invalid RELAY_COUNT value. Using legacy configuration.", "value", relayCountStr)
 			return loadLegacyConfig()
 		}
 
-		log.Printf("Loading %d relay configurations...\n", relayCount)
+		slog.Info("Loading relay configurations...", "count", relayCount)
+		var candidates []RelayConfig
+		var problems []string
 		for i := 1; i <= relayCount; i++ {
 			repoKey := os.Getenv(fmt.Sprintf("DIRECT_EXCHANGE_REPO_KEY_%d", i))
+			if repoKey == "" {
+				// RELAY_REPO_KEYS_<n>만 있으면 첫 번째 키가 대표 키
+				if keys := splitList(os.Getenv(fmt.Sprintf("RELAY_REPO_KEYS_%d", i))); len(keys) > 0 {
+					repoKey = keys[0]
+				}
+			}
 			targetURL := os.Getenv(fmt.Sprintf("RELAY_TARGET_URL_%d", i))
+			// RELAY_ROUTES_<n>만 있으면 RELAY_TARGET_URL_<n>은 없어도 된다.
+			hasRoutes := os.Getenv(fmt.Sprintf("RELAY_ROUTES_%d", i)) != ""
 
-			if repoKey == "" || targetURL == "" {
-				log.Printf("Warning: Missing configuration for relay %d (repo_key=%s, target_url=%s). Skipping.\n",
-					i, repoKey, targetURL)
+			if repoKey == "" || (targetURL == "" && !hasRoutes) {
+				problems = append(problems, fmt.Sprintf("relay %d: missing DIRECT_EXCHANGE_REPO_KEY_%d / RELAY_REPO_KEYS_%d or RELAY_TARGET_URL_%d / RELAY_ROUTES_%d (repo_key=%q, target_url=%q)",
+					i, i, i, i, i, repoKey, targetURL))
 				continue
 			}
 
-			config := RelayConfig{
-				RepoKey:   repoKey,
-				TargetURL: targetURL,
-				Index:     i,
-			}
-			configs = append(configs, config)
-			log.Printf("Relay %d configured: repo=%s, target=%s\n", i, repoKey, targetURL)
+			candidates = append(candidates, newRelayConfig(i, repoKey, targetURL))
+		}
+
+		configs, err := checkRelayConfigs(candidates, problems, allowPartial)
+		if err != nil {
+			return nil, err
+		}
+		if len(configs) != relayCount {
+			slog.Warn("Fewer relays configured than RELAY_COUNT", "configured", len(configs), "relay_count", relayCount)
 		}
 
 		if len(configs) == 0 {
-			log.Println("No valid relay configurations found. Falling back to legacy configuration.")
+			slog.Warn("No valid relay configurations found. Falling back to legacy configuration.")
 			return loadLegacyConfig()
 		}
-	} else {
-		// Use legacy single relay configuration
-		return loadLegacyConfig()
+		return configs, nil
+	}
+
+	// Use legacy single relay configuration
+	return loadLegacyConfig()
+}
+
+// checkRelayConfigs validates the candidates (including repo key uniqueness), reports all problems
+// and returns the valid relays.
+func checkRelayConfigs(candidates []RelayConfig, problems []string, allowPartial bool) ([]RelayConfig, error) {
+	var configs []RelayConfig
+	repoKeyOwners := map[string]int{}
+	for _, config := range candidates {
+		config = normalizeTargetURLs(config)
+		if configProblems := validateRelayConfig(config); len(configProblems) > 0 {
+			problems = append(problems, configProblems...)
+			continue
+		}
+		// 같은 repo key라도 다른 브로커/익스체인지에서 소비하면 중복이 아니다.
+		duplicate := false
+		for _, key := range config.BindKeys {
+			binding := config.BrokerAddr + "\x00" + config.Exchange + "\x00" + key
+			if owner, ok := repoKeyOwners[binding]; ok {
+				problems = append(problems, fmt.Sprintf("relay %d: repo key %s is already used by relay %d", config.Index, key, owner))
+				duplicate = true
+			}
+		}
+		if duplicate {
+			continue
+		}
+		for _, key := range config.BindKeys {
+			repoKeyOwners[config.BrokerAddr+"\x00"+config.Exchange+"\x00"+key] = config.Index
+		}
+
+		configs = append(configs, config)
+		relayLogger(config).Info("Relay configured", "broker_host", urlHost(config.BrokerAddr), "exchange", config.Exchange, "target_urls", redactURLs(config.TargetURLs), "routes", len(config.Routes), "lb_mode", config.LBMode,
+			"timeout_seconds", config.TimeoutSeconds, "signed", config.WebhookSecret != "", "sign_header", config.SignHeader, "forward_format", config.ForwardFormat, "method", config.Method,
+			"auth", config.AuthType, "proxy", redactedProxy(config.ProxyURL), "rate_limit", config.RateLimit, "dry_run", config.DryRun, "shutdown_on_push", config.ShutdownOnPush, "target_token_set", config.TargetToken != "",
+			"template", config.Template != nil, "host_header", config.HostHeader)
 	}
 
-	return configs
+	if err := reportConfigProblems(problems, allowPartial); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// enabledRelays returns the relays to start, logging the ones disabled by RELAY_ENABLED_<n>=0.
+// Returns an error when every relay is disabled.
+// 장애 중에 RELAY_COUNT나 다른 릴레이 설정을 건드리지 않고 릴레이 하나만 끌 수 있다.
+func enabledRelays(configs []RelayConfig) ([]RelayConfig, error) {
+	var enabled []RelayConfig
+	for _, config := range configs {
+		if !config.Enabled {
+			relayLogger(config).Warn("Relay disabled by RELAY_ENABLED. Not starting it.")
+			continue
+		}
+		enabled = append(enabled, config)
+	}
+	if len(enabled) == 0 {
+		return nil, fmt.Errorf("every relay is disabled by RELAY_ENABLED (%d configured)", len(configs))
+	}
+	return enabled, nil
 }
 
 // loadLegacyConfig loads the legacy single relay configuration
-func loadLegacyConfig() []RelayConfig {
+func loadLegacyConfig() ([]RelayConfig, error) {
 	repoKey := os.Getenv("DIRECT_EXCHANGE_REPO_KEY")
+	if keys := splitList(os.Getenv("RELAY_REPO_KEYS")); repoKey == "" && len(keys) > 0 {
+		repoKey = keys[0]
+	}
 	targetURL := os.Getenv("RELAY_TARGET_URL")
 
-	if repoKey == "" || targetURL == "" {
-		log.Fatal("No relay configuration found. Please set either RELAY_COUNT with numbered configurations or legacy DIRECT_EXCHANGE_REPO_KEY and RELAY_TARGET_URL")
+	if repoKey == "" || (targetURL == "" && os.Getenv("RELAY_ROUTES") == "") {
+		return nil, errors.New("no relay configuration found. Please set either RELAY_COUNT with numbered configurations or legacy DIRECT_EXCHANGE_REPO_KEY and RELAY_TARGET_URL")
 	}
 
-	log.Println("Using legacy single relay configuration")
-	return []RelayConfig{{
-		RepoKey:   repoKey,
-		TargetURL: targetURL,
-		Index:     0,
-	}}
+	config := normalizeTargetURLs(newRelayConfig(0, repoKey, targetURL))
+	if problems := validateRelayConfig(config); len(problems) > 0 {
+		// 릴레이가 하나뿐이므로 RELAY_ALLOW_PARTIAL과 관계없이 실패
+		return nil, reportConfigProblems(problems, false)
+	}
+
+	slog.Info("Using legacy single relay configuration")
+	return []RelayConfig{config}, nil
+}
+
+// AllowsEvent reports whether the event type passes RELAY_EVENT_FILTER
+func (c RelayConfig) AllowsEvent(event string) bool {
+	if len(c.EventFilter) == 0 {
+		return true
+	}
+	for _, allowed := range c.EventFilter {
+		if strings.EqualFold(allowed, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated value such as RELAY_TARGET_URL, dropping empty items
+func splitList(str string) []string {
+	var items []string
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newRelayConfig builds a RelayConfig and reads its optional per-relay settings
+func newRelayConfig(index int, repoKey string, targetURL string) RelayConfig {
+	eventMap, err := parseEventMap(relayEnv("GITHUB_EVENT_MAP", index))
+	if err != nil {
+		slog.Warn("Invalid GITHUB_EVENT_MAP. Ignored.", "relay_index", index, "error", err)
+	}
+
+	// 잘못된 헤더나 프록시를 무시하면 인증 헤더 없이, 또는 사내 프록시를 거치지 않고 보내게 되므로 시작하지 않는다.
+	headers, headersErr := parseHeaders(relaySecretEnv("RELAY_HEADERS", index))
+	if headersErr != nil {
+		headers = map[string]string{}
+	}
+	proxyURL, proxyErr := parseProxyURL(relayProxyEnv(index))
+
+	queueName := relayOwnEnv("RMQ_QUEUE_NAME", index)
+	queueDurable := relayEnv("RMQ_QUEUE_DURABLE", index) == "1"
+	if queueDurable && queueName == "" {
+		slog.Warn("RMQ_QUEUE_DURABLE requires RMQ_QUEUE_NAME. Using an ephemeral queue.", "relay_index", index)
+		queueDurable = false
+	}
+	// 만료/길이 제한은 durable 큐에만 적용한다 (임시 큐는 연결과 함께 사라짐).
+	queueTTLMs := relayEnvNonNegativeInt("RELAY_QUEUE_TTL_MS", index, 0)
+	queueMaxLen := relayEnvNonNegativeInt("RELAY_QUEUE_MAXLEN", index, 0)
+	if !queueDurable && (queueTTLMs > 0 || queueMaxLen > 0) {
+		slog.Warn("RELAY_QUEUE_TTL_MS / RELAY_QUEUE_MAXLEN only apply to durable queues (RMQ_QUEUE_DURABLE). Ignored.", "relay_index", index)
+		queueTTLMs, queueMaxLen = 0, 0
+	}
+
+	client, tlsErr := newRelayHTTPClient(index)
+	clientSettings := strings.Join([]string{relayEnv("RELAY_TLS_CA", index), relayEnv("RELAY_TLS_CERT", index), relayEnv("RELAY_TLS_KEY", index),
+		relayEnv("RELAY_TLS_SKIP_VERIFY", index), relayEnv("RELAY_HTTP2", index)}, "\x00")
+	if relayEnv("RELAY_HTTP2", index) == "1" && proxyURL != nil {
+		slog.Warn("RELAY_HTTP2 does not support proxies. RELAY_PROXY_URL / HTTP_PROXY_URL is ignored.", "relay_index", index)
+	}
+	payloadTemplate, templateErr := loadPayloadTemplate(index)
+	routes, routesErr := parseRoutes(relayOwnEnv("RELAY_ROUTES", index))
+	successCodes, successCodesErr := parseStatusCodes(relayEnv("RELAY_SUCCESS_CODES", index))
+	queryMap, queryMapErr := parseQueryMap(relayEnv("RELAY_QUERY_MAP", index))
+	// 무시하면 모든 브랜치를 전달해 막으려던 빌드가 돌므로 시작하지 않는다.
+	branchFilter, branchFilterErr := parseBranchFilter(relayEnv("RELAY_BRANCH_FILTER", index))
+	// none으로 바꾸면 인증 헤더 없이 모든 웹훅을 보내게 되므로 시작하지 않는다.
+	authType, authTypeErr := parseAuthType(relayEnv("RELAY_AUTH_TYPE", index))
+
+	signAlgo := strings.ToLower(relayEnv("RELAY_SIGN_ALGO", index))
+	if signAlgo == "" {
+		signAlgo = defaultSignAlgo
+	}
+
+	userAgent := relayEnv("RELAY_USER_AGENT", index)
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+
+	targetTokenParam := relayEnv("RELAY_TARGET_TOKEN_PARAM", index)
+	if targetTokenParam == "" {
+		targetTokenParam = defaultTargetTokenParam
+	}
+
+	formField := relayEnv("RELAY_FORM_FIELD", index)
+	if formField == "" {
+		formField = defaultFormField
+	}
+
+	prefetch := relayEnvPositiveInt("RMQ_PREFETCH", index, defaultPrefetch)
+	backpressureMode := normalizeBackpressureMode(relayEnv("BACKPRESSURE_MODE", index))
+	backpressureBuffer := relayEnvPositiveInt("BACKPRESSURE_BUFFER", index, defaultBackpressureBuffer)
+	// MANUAL_ACK면 브로커는 ack 하지 않은 메시지를 RMQ_PREFETCH개까지만 보낸다. 전달 중인 것, 버퍼, 새로 받은 것을 합쳐
+	// 그보다 많아야 버리므로, 버퍼가 RMQ_PREFETCH - 2보다 크면 drop 모드는 block과 같다 (기본값 100 > 10 - 2).
+	if (backpressureMode == backpressureDropOldest || backpressureMode == backpressureDropNewest) && os.Getenv("MANUAL_ACK") == "1" && backpressureBuffer > prefetch-2 {
+		slog.Warn("BACKPRESSURE_BUFFER is too large for RMQ_PREFETCH with MANUAL_ACK, so BACKPRESSURE_MODE never drops. Set BACKPRESSURE_BUFFER to at most RMQ_PREFETCH - 2.",
+			"relay_index", index, "mode", backpressureMode, "backpressure_buffer", backpressureBuffer, "prefetch", prefetch)
+	}
+
+	rateLimit := relayEnvNonNegativeFloat("RELAY_RATE_LIMIT", index, 0)
+	// 기본 버스트는 초당 허용량 (1초 분량을 한 번에 보낼 수 있음)
+	rateBurst := relayEnvPositiveInt("RELAY_RATE_BURST", index, max(1, int(math.Ceil(rateLimit))))
+
+	return RelayConfig{
+		Enabled:              relayOwnEnv("RELAY_ENABLED", index) != "0",
+		RepoKey:              repoKey,
+		BindKeys:             bindKeys(repoKey, splitList(relayOwnEnv("RELAY_REPO_KEYS", index))),
+		TargetURLs:           splitList(targetURL),
+		Routes:               routes,
+		BrokerAddr:           relayBrokerAddr(index),
+		Exchange:             relayExchange(index),
+		LBMode:               normalizeLBMode(relayEnv("RELAY_LB_MODE", index)),
+		Index:                index,
+		Method:               normalizeMethod(relayEnv("RELAY_METHOD", index)),
+		TimeoutSeconds:       relayEnvPositiveInt("HTTP_TIMEOUT_SECONDS", index, defaultHTTPTimeoutSeconds),
+		WebhookSecret:        relaySecretEnv("GITHUB_WEBHOOK_SECRET", index),
+		SignHeader:           http.CanonicalHeaderKey(relayEnv("RELAY_SIGN_HEADER", index)),
+		SignSecret:           relaySecretEnv("RELAY_SIGN_SECRET", index),
+		SignAlgo:             signAlgo,
+		ForwardFormat:        normalizeForwardFormat(relayEnv("FORWARD_FORMAT", index)),
+		FormField:            formField,
+		Gzip:                 relayEnv("RELAY_GZIP", index) == "1",
+		EventMap:             eventMap,
+		Template:             payloadTemplate,
+		EventFilter:          splitList(relayEnv("RELAY_EVENT_FILTER", index)),
+		BranchFilter:         branchFilter,
+		UserAgent:            userAgent,
+		Headers:              headers,
+		ForwardGitHubHeaders: relayEnv("RELAY_FORWARD_GITHUB_HEADERS", index) == "1",
+		HeadersOverride:      relayEnv("RELAY_HEADERS_OVERRIDE", index) == "1",
+		TargetToken:          relaySecretEnv("RELAY_TARGET_TOKEN", index),
+		HostHeader:           relayEnv("RELAY_HOST_HEADER", index),
+		TargetTokenParam:     targetTokenParam,
+		QueryMap:             queryMap,
+		AuthType:             authType,
+		AuthUser:             relayEnv("RELAY_AUTH_USER", index),
+		AuthPass:             relaySecretEnv("RELAY_AUTH_PASS", index),
+		AuthToken:            relaySecretEnv("RELAY_AUTH_TOKEN", index),
+		Prefetch:             prefetch,
+		ConsumerExclusive:    relayEnv("RMQ_CONSUMER_EXCLUSIVE", index) == "1",
+		QueueName:            queueName,
+		QueueDurable:         queueDurable,
+		QueueType:            normalizeQueueType(relayEnv("RELAY_QUEUE_TYPE", index)),
+		QueueTTLMs:           queueTTLMs,
+		QueueMaxLen:          queueMaxLen,
+		ProxyURL:             proxyURL,
+		ShutdownOnPush:       relayShutdownOnPush(index),
+		DryRun:               relayDryRun(index),
+		DedupTTLSeconds:      relayEnvNonNegativeInt("RELAY_DEDUP_TTL_SECONDS", index, defaultDedupTTLSeconds),
+		DedupSize:            relayEnvPositiveInt("RELAY_DEDUP_SIZE", index, defaultDedupSize),
+		RateLimit:            rateLimit,
+		RateBurst:            rateBurst,
+		DelayMs:              relayEnvNonNegativeInt("RELAY_DELAY_MS", index, 0),
+		MaxMessageAgeSeconds: relayEnvNonNegativeInt("MAX_MESSAGE_AGE_SECONDS", index, 0),
+		MaxPayloadBytes:      relayEnvNonNegativeInt("MAX_PAYLOAD_BYTES", index, defaultMaxPayloadBytes),
+		BackpressureMode:     backpressureMode,
+		BackpressureBuffer:   backpressureBuffer,
+
+		PostMaxRetries:     relayEnvNonNegativeInt("POST_MAX_RETRIES", index, defaultPostMaxRetries),
+		PostRetryBackoffMs: relayEnvPositiveInt("POST_RETRY_BACKOFF_MS", index, defaultPostRetryBackoffMs),
+
+		CircuitThreshold:       relayEnvNonNegativeInt("RELAY_CIRCUIT_THRESHOLD", index, 0),
+		CircuitCooldownSeconds: relayEnvPositiveInt("RELAY_CIRCUIT_COOLDOWN_SECONDS", index, defaultCircuitCooldownSeconds),
+
+		SuccessCodes: successCodes,
+
+		rotation:        &atomic.Uint64{},
+		client:          client,
+		clientSettings:  clientSettings,
+		tlsErr:          tlsErr,
+		templateErr:     templateErr,
+		routesErr:       routesErr,
+		successCodesErr: successCodesErr,
+		queryMapErr:     queryMapErr,
+		branchFilterErr: branchFilterErr,
+		headersErr:      headersErr,
+		proxyErr:        proxyErr,
+		authTypeErr:     authTypeErr,
+	}
 }
 
 func main() {
-	log.Println("github-mq-to-post-relay started")
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
 
-	goDotErr := godotenv.Load()
+	// SIGHUP으로 다시 읽을 때 .env에서 온 변수만 바꿀 수 있도록 출처를 기억한다.
+	goDotErr := loadDotenv()
+
+	// LOG_LEVEL은 .env에서도 읽을 수 있도록 로드 후에 설정
+	setupLogger()
+	slog.Info("github-mq-to-post-relay started", "version", version, "commit", commit, "build_date", buildDate)
 	if goDotErr != nil {
-		log.Println("Error loading .env file")
+		slog.Warn("Error loading .env file", "error", goDotErr)
 	}
 
-	shutdownCh = make(chan string)
-
 	// Load relay configurations
-	configs := loadRelayConfigs()
-	log.Printf("Loaded %d relay configuration(s)\n", len(configs))
+	configs, err := loadRelayConfigs()
+	if err == nil {
+		slog.Info("Loaded relay configurations", "count", len(configs))
+		logEffectiveConfig(configs)
+		configs, err = enabledRelays(configs)
+	}
+	if err != nil {
+		slog.Error("Loading relay configuration failed", "error", err)
+		os.Exit(1)
+	}
+
+	// SIGTERM/SIGINT를 받으면 ctx가 취소되고, 모든 릴레이가 소비를 멈춘다.
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithCancelCause(signalCtx)
+	defer cancel(nil)
+	requestShutdown = cancel
+	// SIGUSR1: 종료하지 않고 소비만 멈추거나 다시 시작한다 (점검 시간용).
+	watchPauseSignal(ctx)
+
+	// OTEL_EXPORTER_OTLP_ENDPOINT가 없으면 트레이싱은 no-op
+	shutdownTracing := setupTracing(ctx)
+
+	// 종료 요청 후에도 진행 중인 요청은 SHUTDOWN_GRACE_SECONDS 동안 끝까지 보낸다.
+	shutdownGracePeriod := time.Duration(envPositiveInt("SHUTDOWN_GRACE_SECONDS", defaultShutdownGraceSeconds)) * time.Second
+	var cancelInFlight context.CancelFunc
+	inFlightCtx, cancelInFlight = context.WithCancel(context.Background())
+	defer cancelInFlight()
+
+	// 모든 릴레이가 하나의 클라이언트(커넥션 풀)를 공유한다.
+	client := newHTTPClient()
+
+	// REPLAY_TOKEN이 있으면 최근 페이로드를 보관해 /replay로 다시 보낼 수 있다.
+	replays = newReplayStore(client)
+	// INJECT_TOKEN이 있으면 /inject로 시험 메시지를 보낼 수 있다.
+	injector = newInjectHandler(client)
 
 	// Use WaitGroup to manage goroutines
 	var wg sync.WaitGroup
+	relays = newRelayManager(ctx, client, &wg)
 
-	// Start a goroutine for each relay configuration
-	for _, config := range configs {
+	if spoolDir := os.Getenv("SPOOL_DIR"); spoolDir != "" {
+		spool, err = newPayloadSpool(spoolDir, int64(envPositiveInt("SPOOL_MAX_MB", defaultSpoolMaxMB))<<20)
+		if err != nil {
+			slog.Error("Creating SPOOL_DIR failed", "dir", spoolDir, "error", err)
+			os.Exit(1)
+		}
+
+		retryInterval := time.Duration(envPositiveInt("SPOOL_RETRY_SECONDS", defaultSpoolRetrySeconds)) * time.Second
+		slog.Info("Spooling undeliverable webhooks to disk", "dir", spoolDir, "retry_interval", retryInterval.String())
 		wg.Add(1)
-		go func(cfg RelayConfig) {
+		go func() {
 			defer wg.Done()
+			spool.Run(ctx, retryInterval, client, relays.Configs)
+		}()
+	}
 
-			logPrefix := fmt.Sprintf("[Relay %d - %s]", cfg.Index, cfg.RepoKey)
+	if auditFile := os.Getenv("AUDIT_FILE"); auditFile != "" {
+		audit, err = newAuditLog(auditFile, int64(envPositiveInt("AUDIT_MAX_MB", defaultAuditMaxMB))<<20)
+		if err != nil {
+			slog.Error("Opening AUDIT_FILE failed", "file", auditFile, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Writing an audit record for every forwarded message", "file", auditFile)
+	}
 
-			for {
-				log.Printf("%s Starting listener...\n", logPrefix)
-				err := listenForGitHubPush(cfg)
-				if err != nil {
-					const retryInterval = 60
-					log.Printf("%s Error '%v' returned from listenForGitHubPush(). (Check github-org-webhook-center running!) Retry in %v seconds...",
-						logPrefix, err, retryInterval)
-					<-time.After(retryInterval * time.Second)
-				}
-			}
-		}(config)
+	// Start a goroutine for each relay configuration
+	// 헬스 서버가 뜨기 전에 모든 릴레이가 등록되어 있어야 /ready가 올바르다.
+	relays.Start(configs)
+	startHealthServer()
+	// SIGHUP: 설정을 다시 읽어 바뀐 릴레이만 다시 시작한다.
+	watchReloadSignal(ctx)
+	// STARTUP_HEALTHCHECK=1: 대상마다 HEAD 요청을 보내 연결할 수 있는지 알려준다. 릴레이 시작을 기다리게 하지 않는다.
+	if os.Getenv("STARTUP_HEALTHCHECK") == "1" {
+		go checkTargets(ctx, client, configs)
 	}
 
-	// Wait for all goroutines to complete (they won't in normal operation)
-	wg.Wait()
+	// Wait for all goroutines to complete (only after a shutdown signal)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutdown requested. Waiting for in-flight requests...", "cause", context.Cause(ctx), "grace_period", shutdownGracePeriod.String())
+
+	select {
+	case <-done:
+		// 남은 span을 내보낸 뒤 종료
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFlush()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Warn("Flushing traces failed", "error", err)
+		}
+		if errors.Is(context.Cause(ctx), errAllRelaysGaveUp) {
+			slog.Error("github-mq-to-post-relay stopped: every relay gave up reconnecting")
+			os.Exit(1)
+		}
+		if errors.Is(context.Cause(ctx), errFatalBrokerError) {
+			slog.Error("github-mq-to-post-relay stopped: fatal broker error (RMQ_FATAL_ERROR_POLICY=exit)")
+			os.Exit(1)
+		}
+		slog.Info("github-mq-to-post-relay stopped")
+	case <-time.After(shutdownGracePeriod):
+		// 남은 요청을 취소하고, 실패 처리(nack/spool)가 끝날 시간을 조금 준 뒤 종료
+		slog.Error("Grace period exceeded. Cancelling remaining requests.", "grace_period", shutdownGracePeriod.String())
+		cancelInFlight()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+		slog.Error("github-mq-to-post-relay stopped without draining")
+		os.Exit(1)
+	}
+}
+
+// newAMQPConfig builds the connection settings shared by all relays.
+// 짧은 heartbeat는 조용히 끊긴 연결을 빨리 감지해 재접속 루프로 넘어가게 한다.
+func newAMQPConfig() amqp.Config {
+	channelMax := envNonNegativeInt("RMQ_CHANNEL_MAX", 0)
+	if channelMax > math.MaxUint16 {
+		slog.Warn("Invalid value. Using default.", "name", "RMQ_CHANNEL_MAX", "value", channelMax, "default", 0)
+		channelMax = 0
+	}
+
+	locale := os.Getenv("RMQ_LOCALE")
+	if locale == "" {
+		locale = defaultAMQPLocale
+	}
+
+	return amqp.Config{
+		Properties: amqp.NewConnectionProperties(),
+		Heartbeat:  time.Duration(envPositiveInt("RMQ_HEARTBEAT_SECONDS", defaultHeartbeatSeconds)) * time.Second,
+		ChannelMax: uint16(channelMax),
+		Locale:     locale,
+		Dial:       amqp.DefaultDial(time.Duration(envPositiveInt("RMQ_DIAL_TIMEOUT_SECONDS", defaultDialTimeoutSeconds)) * time.Second),
+	}
 }
 
-func listenForGitHubPush(config RelayConfig) error {
+// listenForGitHubPush connects to the relay's broker and consumes its queue (consumeRelay)
+// until the connection closes or ctx is cancelled. Returns nil when stopped by ctx.
+func listenForGitHubPush(ctx context.Context, config RelayConfig, client httpDoer, dedup *dedupCache) error {
 	// ADDR_'ROOT': 특정 virtual host 속한 것이 아니라 공용
-	amqpConfig := amqp.Config{Properties: amqp.NewConnectionProperties()}
-	amqpConfig.Properties.SetClientConnectionName(fmt.Sprintf("github-mq-to-post-relay:%s", config.RepoKey))
-	conn, err := amqp.DialConfig(os.Getenv("RMQ_ADDR_ROOT"), amqpConfig)
+	amqpConfig := newAMQPConfig()
+	amqpConfig.Properties.SetClientConnectionName(connectionName(config))
+
+	addr := config.BrokerAddr
+	if strings.HasPrefix(strings.ToLower(addr), "amqps://") {
+		tlsConfig, err := loadRMQTLSConfig()
+		if err != nil {
+			return fmt.Errorf("rabbitmq tls config: %w", err)
+		}
+		amqpConfig.TLSClientConfig = tlsConfig
+	}
+
+	conn, err := amqp.DialConfig(addr, amqpConfig)
 	if err != nil {
 		return err
 	}
 	defer func(conn *amqp.Connection) {
 		err := conn.Close()
 		if err != nil {
-			log.Printf("closing connection failed: %v\n", err)
+			slog.Warn("closing connection failed", "error", err)
 		}
 	}(conn)
 
@@ -157,67 +718,395 @@ func listenForGitHubPush(config RelayConfig) error {
 	defer func(ch *amqp.Channel) {
 		err := ch.Close()
 		if err != nil {
-			log.Printf("closing channel failed: %v\n", err)
+			slog.Warn("closing channel failed", "error", err)
 		}
 	}(ch)
 
-	err = ch.Confirm(false)
-	if err != nil {
+	return consumeRelay(ctx, amqpChannel{ch}, onClose, config, client, dedup)
+}
+
+// consumeRelay declares and binds the relay's queue on ch and forwards its messages
+// until onClose fires (returns the close error) or ctx is cancelled (returns nil).
+func consumeRelay(ctx context.Context, ch brokerChannel, onClose <-chan *amqp.Error, config RelayConfig, client httpDoer, dedup *dedupCache) error {
+	// Confirm 모드: dead-letter exchange로 다시 발행한 메시지를 브로커가 받았는지 확인한 뒤에 원본을 ack 하기 위해 필요하다.
+	// (이 채널에서 발행하는 것은 dead-letter 메시지뿐이다.)
+	if err := ch.Confirm(false); err != nil {
 		return err
 	}
 
-	queueName := ""
+	// 기본은 접속이 끊기면 사라지는 임시 큐 (exclusive, auto-delete).
+	// RMQ_QUEUE_DURABLE=1이면 이름 있는 durable 큐를 써서 끊겨 있는 동안의 메시지도 보관한다.
+	durable, autoDelete, exclusive := false, true, true
+	if config.QueueDurable {
+		durable, autoDelete, exclusive = true, false, false
+	}
+	args := config.queueArguments()
+	// 브로커가 컨슈머를 취소하면 (큐 삭제, quorum 큐 리더 변경 등) deliveries가 닫히기 전에 태그가 온다.
+	// 일시 정지로 직접 취소할 때는 오지 않는다.
+	brokerCancels := ch.NotifyCancel(make(chan string, 1))
 
-	q, err := ch.QueueDeclare(
-		queueName,
-		false,
-		true,
-		true,
-		false,
-		nil)
+	declareQueue := func() (amqp.Queue, error) {
+		q, err := ch.QueueDeclare(
+			config.QueueName,
+			durable,
+			autoDelete,
+			exclusive,
+			false,
+			args)
+		if err != nil {
+			return q, err
+		}
+
+		// topic 익스체인지면 repo key를 패턴 그대로 바인딩한다 (예: MyOrg.*). 익스체인지 선언은 하지 않는다.
+		// RELAY_REPO_KEYS가 있으면 같은 큐에 여러 키를 바인딩해 컨슈머 하나가 모두 처리한다.
+		for _, key := range config.BindKeys {
+			err = ch.QueueBind(
+				q.Name,
+				key,
+				config.Exchange,
+				false,
+				nil,
+			)
+			if err != nil {
+				return q, err
+			}
+		}
+		return q, nil
+	}
+	q, err := declareQueue()
 	if err != nil {
 		return err
 	}
 
-	err = ch.QueueBind(
-		q.Name,
-		config.RepoKey,
-		os.Getenv("RMQ_EXCHANGE_NAME"),
-		false,
-		nil,
-	)
+	// MANUAL_ACK=1: POST가 성공했을 때만 ack, 실패하면 nack 해서 다시 큐에 넣는다.
+	manualAck := os.Getenv("MANUAL_ACK") == "1"
+
+	// Consume 전에 설정해야 적용된다.
+	err = ch.Qos(config.Prefetch, 0, false)
 	if err != nil {
 		return err
 	}
 
-	deliveries, err := ch.Consume(
-		q.Name,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
+	// 관리 UI에서 어느 릴레이의 컨슈머인지 알 수 있도록 태그를 붙인다 (연결 이름과 같은 방식).
+	consumerTag := fmt.Sprintf("%s:%s:%d", consumerTagPrefix(), config.RepoKey, config.Index)
+
+	// SIGUSR1로 일시 정지하면 컨슈머를 취소하고, 받아둔 메시지를 모두 처리하면 deliveries가 닫힌다.
+	// consuming은 컨슈머가 살아 있는지, deliveries != nil은 아직 처리할 메시지가 남아 있을 수 있는지를 뜻한다.
+	var deliveries <-chan amqp.Delivery
+	consuming := false
+	// BACKPRESSURE_MODE=drop-*: 버퍼를 채우는 goroutine은 이 함수가 끝나면 멈춘다.
+	stopBackpressure := make(chan struct{})
+	defer close(stopBackpressure)
+	startConsumer := func() error {
+		deliveries, err = ch.Consume(
+			q.Name,
+			consumerTag,
+			!manualAck,
+			config.ConsumerExclusive,
+			false, // noLocal은 RabbitMQ가 지원하지 않는다
+			false,
+			nil,
+		)
+		consuming = err == nil
+		if consuming {
+			deliveries = applyBackpressure(deliveries, stopBackpressure, config, manualAck, relayLogger(config))
+		}
 		return err
 	}
+	paused, pauseChanged := consumePause.State()
+	if !paused {
+		if err := startConsumer(); err != nil {
+			return err
+		}
+	}
 
-	log.Printf("[Relay %d - %s] Listening GitHub push from queue %v\n", config.Index, config.RepoKey, q.Name)
+	// MANUAL_ACK에서 계속 실패하는 메시지가 무한히 재큐잉되지 않도록
+	// RMQ_MAX_REDELIVERIES 번 실패하면 RMQ_DLX_NAME으로 보내고 (없으면 버리고) ack 한다.
+	maxRedeliveries := envNonNegativeInt("RMQ_MAX_REDELIVERIES", defaultMaxRedeliveries)
+	dlxName := os.Getenv("RMQ_DLX_NAME")
+	redeliveries := newRedeliveryTracker()
+
+	// RELAY_RATE_LIMIT: 한도를 넘으면 버리지 않고 기다린다 (MANUAL_ACK면 메시지는 브로커에 남아 있음)
+	var limiter *rate.Limiter
+	if config.RateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(config.RateLimit), config.RateBurst)
+	}
+
+	// 이름 있는 큐만 깊이를 확인한다 (임시 큐는 연결과 함께 사라지므로 쌓일 일이 없다).
+	var depthTick <-chan time.Time
+	if interval := envNonNegativeInt("RMQ_QUEUE_DEPTH_INTERVAL_SECONDS", defaultQueueDepthIntervalSeconds); interval > 0 && config.QueueName != "" {
+		depthTicker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer depthTicker.Stop()
+		depthTick = depthTicker.C
+	}
+	depthWarn := envNonNegativeInt("RMQ_QUEUE_DEPTH_WARN", 0)
+
+	// HEARTBEAT_LOG_SECONDS: 푸시가 없는 동안에도 살아 있는 릴레이와 죽은 릴레이를 로그로 구분할 수 있게 한다.
+	// 상태는 이 루프에서만 바뀌므로 별도 goroutine 없이 같은 select에서 남긴다.
+	var heartbeatTick <-chan time.Time
+	if interval := envNonNegativeInt("HEARTBEAT_LOG_SECONDS", 0); interval > 0 {
+		heartbeatTicker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer heartbeatTicker.Stop()
+		heartbeatTick = heartbeatTicker.C
+	}
+	receivedSinceHeartbeat := 0
+
+	relayStates.SetConnected(config.Index)
+	relayStates.SetPaused(config.Index, paused)
+
+	// skip ends the span of a message that is not forwarded and acks it with MANUAL_ACK, so it does not pile up in the queue.
+	skip := func(d amqp.Delivery, span trace.Span, reason string) error {
+		span.SetAttributes(attribute.String("relay.skipped", reason))
+		span.End()
+		if manualAck {
+			return d.Ack(false)
+		}
+		return nil
+	}
+
+	logger := relayLogger(config)
+	logger.Info("Listening GitHub push", "queue", q.Name, "consumer_tag", consumerTag, "exchange_type", exchangeType(), "manual_ack", manualAck,
+		"exclusive_consumer", config.ConsumerExclusive, "paused", paused)
+
+	// 일시 정지를 푼 뒤 컨슈머를 다시 시작한다. auto-delete 큐는 컨슈머를 취소할 때 지워졌으므로 다시 선언한다.
+	resume := func() error {
+		if autoDelete {
+			var err error
+			if q, err = declareQueue(); err != nil {
+				return err
+			}
+		}
+		logger.Info("Resuming consumer", "queue", q.Name)
+		return startConsumer()
+	}
 
 loop:
 	for {
 		select {
-		case d := <-deliveries:
-			if os.Getenv("SHUTDOWN_ON_GITHUB_PUSH") == "1" {
-				shutdownCh <- "push from github"
+		case d, ok := <-deliveries:
+			if !ok {
+				if consuming {
+					// 재접속 루프에서 다시 시작한다.
+					select {
+					case tag, cancelled := <-brokerCancels:
+						if cancelled {
+							consumerCancelled.WithLabelValues(relayLabelValues(config)...).Inc()
+							logger.Warn("Consumer cancelled by the broker (queue deleted?). Reconnecting.", "queue", q.Name, "consumer_tag", tag)
+							return errConsumerCancelled
+						}
+					default:
+					}
+					return errors.New("delivery channel closed")
+				}
+				// 일시 정지로 취소한 컨슈머가 받아둔 메시지를 모두 처리했다.
+				deliveries = nil
+				if paused {
+					logger.Info("Paused. Every message already received has been processed.")
+				} else if err := resume(); err != nil {
+					return err
+				}
+				continue
+			}
+			if ctx.Err() != nil && manualAck {
+				// 종료 요청 후에 꺼낸 메시지는 전달하지 않고 큐로 돌려보낸다 (select가 ctx.Done보다 먼저 고를 수 있다).
+				if err = d.Nack(false, true); err != nil {
+					return err
+				}
+				continue
+			}
+			messagesReceived.WithLabelValues(relayLabelValues(config)...).Inc()
+			receivedSinceHeartbeat++
+
+			// 메시지 하나의 수신부터 결과까지 모든 로그 줄에 같은 correlation_id를 남긴다.
+			correlationID := newCorrelationID()
+			msgLogger := logger.With("correlation_id", correlationID)
+			msgCtx, span := startDeliverySpan(withCorrelationID(inFlightCtx, correlationID), d, config)
+			span.SetAttributes(attribute.String("relay.correlation_id", correlationID))
+			msgLogger.Debug("Message received", "routing_key", d.RoutingKey, "redelivered", d.Redelivered)
+
+			// 아래의 대기(RELAY_RATE_LIMIT, RELAY_DELAY_MS)는 종료 요청에 취소된다.
+			// 종료를 요청한 메시지 자체는 SIGTERM 때 진행 중인 요청처럼 유예 시간 안에서 끝까지 전달한다.
+			waitCtx := ctx
+			if config.ShutdownOnPush {
+				msgLogger.Info("Push from GitHub detected. Shutdown on push is enabled for this relay, stopping all relays after forwarding it.")
+				requestShutdown(errors.New("push from github"))
+				waitCtx = inFlightCtx
+			} else {
+				msgLogger.Debug("Push from GitHub detected, but shutdown on push is not enabled for this relay. Ignored.")
+			}
+
+			// MAX_PAYLOAD_BYTES: 필터가 본문을 파싱하거나 form 인코딩으로 메모리를 두 배로 쓰기 전에 거대한 메시지 하나를 걸러낸다.
+			if config.MaxPayloadBytes > 0 && len(d.Body) > config.MaxPayloadBytes {
+				sizeErr := fmt.Errorf("payload of %d bytes exceeds MAX_PAYLOAD_BYTES (%d)", len(d.Body), config.MaxPayloadBytes)
+				msgLogger.Error("Payload is larger than MAX_PAYLOAD_BYTES. Dropped.", "payload_bytes", len(d.Body), "max_payload_bytes", config.MaxPayloadBytes,
+					"routing_key", d.RoutingKey, "delivery_id", deliveryHeader(d, "X-GitHub-Delivery"))
+				oversizeDropped.WithLabelValues(relayLabelValues(config)...).Inc()
+				if dlxName != "" {
+					if dlxErr := publishDeadLetter(ch, dlxName, d, sizeErr); dlxErr == nil {
+						msgLogger.Warn("Moved oversized message to dead-letter exchange", "dlx", dlxName)
+					} else if !manualAck {
+						msgLogger.Error("Publishing to dead-letter exchange failed", "dlx", dlxName, "error", dlxErr)
+					} else if failures := redeliveries.Failed(d); maxRedeliveries == 0 || failures <= maxRedeliveries {
+						// 브로커가 확인해주지 않았으면 원본을 버리지 않고 다시 큐에 넣는다.
+						// 받을 수 없는 DLX라면 바로 다시 받아 계속 돌게 되므로 RMQ_MAX_REDELIVERIES 번까지만 한다.
+						msgLogger.Error("Publishing to dead-letter exchange failed. Requeueing message.", "dlx", dlxName, "error", dlxErr, "failures", failures)
+						span.SetAttributes(attribute.String("relay.skipped", "oversize"))
+						span.End()
+						if err = d.Nack(false, true); err != nil {
+							return err
+						}
+						continue
+					} else {
+						msgLogger.Error("Publishing to dead-letter exchange failed repeatedly. Dropping message.", "dlx", dlxName, "error", dlxErr, "failures", failures)
+					}
+					redeliveries.Forget(d)
+				}
+				if err = skip(d, span, "oversize"); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if reason := skipReason(d, config, dedup, msgLogger); reason != "" {
+				if err = skip(d, span, reason); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if limiter != nil {
+				if waitErr := limiter.Wait(waitCtx); waitErr != nil && manualAck {
+					// 종료 중이면 전달하지 않은 메시지를 큐로 돌려보낸다. auto-ack는 이미 ack 됐으므로 그대로 전달.
+					span.End()
+					if err = d.Nack(false, true); err != nil {
+						return err
+					}
+					break loop
+				}
+			}
+
+			// RELAY_DELAY_MS: 내부 미러가 푸시를 따라잡을 시간을 준다. 종료 중이면 기다리지 않는다.
+			if config.DelayMs > 0 {
+				select {
+				case <-time.After(time.Duration(config.DelayMs) * time.Millisecond):
+				case <-waitCtx.Done():
+					if manualAck {
+						// 전달하지 않은 메시지를 큐로 돌려보낸다. auto-ack는 이미 ack 됐으므로 바로 전달.
+						span.End()
+						if err = d.Nack(false, true); err != nil {
+							return err
+						}
+						break loop
+					}
+				}
+			}
+
+			replays.Remember(config.Index, d)
+			result := postToUrl(msgCtx, client, d, config)
+			postErr := result.Err
+			relayStates.RecordMessage(config.Index, postErr)
+			if postErr == nil {
+				msgLogger.Info("Forwarded", "status_code", result.StatusCode, "attempts", result.Attempts, "duration", result.Duration.String())
 			} else {
-				log.Printf("[Relay %d - %s] Push from GitHub detected, but SHUTDOWN_ON_GITHUB_PUSH is not enabled. Ignored.", config.Index, config.RepoKey)
+				msgLogger.Error("Forwarding failed", "error", postErr, "status_code", result.StatusCode, "attempts", result.Attempts, "duration", result.Duration.String())
+
+				// SPOOL_DIR: 디스크에 저장했으면 나중에 재전송하므로 성공으로 처리
+				if spool != nil {
+					if spoolErr := spool.Save(d, config); spoolErr != nil {
+						msgLogger.Error("Spooling webhook failed", "error", spoolErr)
+					} else {
+						msgLogger.Warn("Webhook spooled to disk for later delivery")
+						postErr = nil
+					}
+				}
 			}
 
-			postToUrl(d.Body, config.TargetURL, config.Index, config.RepoKey)
-		case <-shutdownCh:
+			if postErr == nil {
+				dedup.Remember(d)
+			}
+
+			// 회로가 열려 아무것도 보내지 않았으면 실패로 세지 않고 돌려보낸 뒤, 바로 다시 받지 않도록 쿨다운 동안 쉰다.
+			var circuitErr errCircuitOpen
+			circuitOpen := postErr != nil && errors.As(postErr, &circuitErr)
+
+			if manualAck {
+				if postErr == nil {
+					redeliveries.Forget(d)
+					err = d.Ack(false)
+				} else if circuitOpen {
+					msgLogger.Warn("Requeueing message while the target's circuit is open", "retry_in", circuitErr.RetryIn.String())
+					err = d.Nack(false, true)
+				} else if failures := redeliveries.Failed(d); maxRedeliveries > 0 && failures > maxRedeliveries {
+					if dlxName == "" {
+						msgLogger.Error("Dropping message after repeated failures (RMQ_DLX_NAME not set)", "failures", failures)
+						redeliveries.Forget(d)
+						err = d.Ack(false)
+					} else if dlxErr := publishDeadLetter(ch, dlxName, d, postErr); dlxErr != nil {
+						// 브로커가 확인해주지 않았으면 원본을 버리지 않고 다시 큐에 넣는다.
+						msgLogger.Error("Publishing to dead-letter exchange failed. Requeueing message.", "dlx", dlxName, "error", dlxErr)
+						err = d.Nack(false, true)
+					} else {
+						msgLogger.Warn("Moved message to dead-letter exchange after repeated failures", "dlx", dlxName, "failures", failures)
+						redeliveries.Forget(d)
+						err = d.Ack(false)
+					}
+				} else {
+					msgLogger.Warn("Requeueing message after failed POST", "failures", failures)
+					err = d.Nack(false, true)
+				}
+			}
+			endSpan(span, postErr)
+			if err != nil {
+				return err
+			}
+			if circuitOpen && manualAck {
+				select {
+				case <-time.After(circuitErr.RetryIn):
+				case <-ctx.Done():
+				}
+			}
+		case <-heartbeatTick:
+			logger.Info("Relay alive", "connected", true, "consuming", consuming, "paused", paused, "queue", q.Name,
+				"messages_since_last", receivedSinceHeartbeat)
+			receivedSinceHeartbeat = 0
+		case <-depthTick:
+			// POST 사이에만 확인하므로 전달이 오래 걸리면 간격이 늘어날 수 있다.
+			inspected, err := ch.QueueDeclarePassive(q.Name, durable, autoDelete, exclusive, false, args)
+			if err != nil {
+				// passive declare 실패는 채널을 닫으므로 재접속 루프로 넘긴다.
+				return fmt.Errorf("inspect queue %s: %w", q.Name, err)
+			}
+			queueDepth.WithLabelValues(relayLabelValues(config)...).Set(float64(inspected.Messages))
+			if depthWarn > 0 && inspected.Messages >= depthWarn {
+				logger.Warn("Queue is growing. The relay cannot keep up.", "queue", q.Name, "messages", inspected.Messages, "threshold", depthWarn)
+			} else {
+				logger.Debug("Queue depth", "queue", q.Name, "messages", inspected.Messages)
+			}
+		case <-ctx.Done():
+			// 처리 중인 POST는 이미 끝났으므로 바로 종료 (채널/연결은 defer로 닫힘).
+			// 먼저 컨슈머를 취소해 브로커가 새 메시지를 보내지 않게 한다. 받아두고 ack 하지 않은 메시지는 채널이 닫힐 때 큐로 돌아간다.
+			if consuming {
+				logger.Info("Stopping consumer")
+				if err := ch.Cancel(consumerTag, false); err != nil {
+					logger.Warn("Cancelling consumer failed", "error", err)
+				}
+			}
 			break loop
+		case <-pauseChanged:
+			paused, pauseChanged = consumePause.State()
+			relayStates.SetPaused(config.Index, paused)
+			if paused && consuming {
+				logger.Info("Pausing consumer. Finishing the messages already received.")
+				if err := ch.Cancel(consumerTag, false); err != nil {
+					return err
+				}
+				consuming = false
+			} else if !paused && !consuming && deliveries == nil {
+				// 아직 받아둔 메시지를 처리 중이면 deliveries가 닫힐 때 다시 시작한다.
+				if err := resume(); err != nil {
+					return err
+				}
+			}
 		case onCloseValue := <-onClose:
 			// RMQ 접속 끊겼을 때
 			return onCloseValue
@@ -227,59 +1116,220 @@ loop:
 	return nil
 }
 
-func postToUrl(jsonPayload []byte, targetURL string, relayIndex int, repoKey string) {
-	logPrefix := fmt.Sprintf("[Relay %d - %s]", relayIndex, repoKey)
+// skipReason returns why the message must not be forwarded (the relay.skipped span attribute),
+// or "" to forward it: RELAY_EVENT_FILTER, RELAY_BRANCH_FILTER, RELAY_ROUTES without a match,
+// MAX_MESSAGE_AGE_SECONDS and RELAY_DEDUP_TTL_SECONDS, in that order.
+func skipReason(d amqp.Delivery, config RelayConfig, dedup *dedupCache, logger *slog.Logger) string {
+	if event := eventType(d, config); !config.AllowsEvent(event) {
+		logger.Debug("Event filtered out by RELAY_EVENT_FILTER. Skipped.", "event", event)
+		return "event_filter"
+	}
+	if ref, ok := config.AllowsRef(d.Body); !ok {
+		logger.Debug("Ref filtered out by RELAY_BRANCH_FILTER. Skipped.", "ref", ref)
+		return "branch_filter"
+	}
+	if len(config.targetsFor(d.RoutingKey)) == 0 {
+		// RELAY_ROUTES 중 맞는 것이 없고 RELAY_TARGET_URL도 없으면 보낼 곳이 없다.
+		logger.Warn("No route matches the routing key. Skipped.", "routing_key", d.RoutingKey)
+		return "no_route"
+	}
+	// MAX_MESSAGE_AGE_SECONDS: 장애 뒤 몇 시간 묵은 메시지로 옛 커밋을 빌드하지 않는다. timestamp가 없으면 그대로 전달.
+	if age := time.Since(d.Timestamp); config.MaxMessageAgeSeconds > 0 && !d.Timestamp.IsZero() && age > time.Duration(config.MaxMessageAgeSeconds)*time.Second {
+		logger.Warn("Message is older than MAX_MESSAGE_AGE_SECONDS. Dropped.", "age", age.Round(time.Second).String(),
+			"timestamp", d.Timestamp, "delivery_id", deliveryHeader(d, "X-GitHub-Delivery"))
+		staleDropped.WithLabelValues(relayLabelValues(config)...).Inc()
+		return "stale"
+	}
+	if dedup.Seen(d) {
+		logger.Info("Duplicate delivery within RELAY_DEDUP_TTL_SECONDS. Skipped.", "delivery_key", deliveryKey(d), "redelivered", d.Redelivered)
+		return "duplicate"
+	}
+	return ""
+}
 
-	// 1. 폼 필드 정의
-	form := url.Values{}
-	form.Set("payload", string(jsonPayload))
+// bindKeys returns the primary repo key followed by the extra RELAY_REPO_KEYS, without duplicates
+func bindKeys(repoKey string, extra []string) []string {
+	var keys []string
+	for _, key := range append([]string{repoKey}, extra...) {
+		if key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
 
-	encoded := form.Encode()
+// Supported RELAY_QUEUE_TYPE values
+const (
+	queueTypeClassic = "classic"
+	queueTypeQuorum  = "quorum" // replicated; must be durable, non-exclusive and non-auto-delete
+)
 
-	log.Printf("%s ====Payload Begin====", logPrefix)
-	log.Println(string(encoded))
-	log.Printf("%s ====Payload End====", logPrefix)
+// normalizeQueueType lower-cases RELAY_QUEUE_TYPE, defaulting to classic.
+// Unsupported values are kept so validateRelayConfig can reject them.
+func normalizeQueueType(queueType string) string {
+	if queueType == "" {
+		return queueTypeClassic
+	}
+	return strings.ToLower(queueType)
+}
 
-	// 2. Create request with context (here we give it a 10 s timeout)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// queueArguments returns the x-arguments of the relay's queue (nil when none are set).
+// 이미 있는 큐와 인자가 다르면 브로커가 선언을 거부(PRECONDITION_FAILED)하므로 바꿀 때는 큐를 지워야 한다.
+func (c RelayConfig) queueArguments() amqp.Table {
+	if c.QueueType != queueTypeQuorum && c.QueueTTLMs == 0 && c.QueueMaxLen == 0 {
+		return nil
+	}
+	args := amqp.Table{}
+	if c.QueueType == queueTypeQuorum {
+		args["x-queue-type"] = queueTypeQuorum
+	}
+	if c.QueueTTLMs > 0 {
+		args["x-message-ttl"] = int64(c.QueueTTLMs)
+	}
+	if c.QueueMaxLen > 0 {
+		args["x-max-length"] = int64(c.QueueMaxLen)
+	}
+	return args
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, io.NopCloser(strings.NewReader(encoded)))
+// relayBrokerAddr returns RMQ_ADDR_<n> if set, otherwise the shared RMQ_ADDR_ROOT,
+// with the virtual host replaced by RMQ_VHOST_<n> / RMQ_VHOST when set.
+// 브로커 클러스터를 옮기는 동안 릴레이마다 다른 브로커를 쓸 수 있다.
+func relayBrokerAddr(index int) string {
+	addr := secretEnv("RMQ_ADDR_ROOT")
+	if index > 0 {
+		if own := secretEnv(fmt.Sprintf("RMQ_ADDR_%d", index)); own != "" {
+			addr = own
+		}
+	}
+	if vhost := relayEnv("RMQ_VHOST", index); vhost != "" && addr != "" {
+		return withVhost(addr, vhost)
+	}
+	return addr
+}
+
+// withVhost replaces the virtual host (the URL path) of the AMQP address.
+// vhost 이름은 경로 한 칸으로 인코딩하므로 기본 vhost "/"는 "%2F"가 된다.
+// 주소를 해석할 수 없으면 그대로 두고, 접속할 때 나는 오류로 알린다.
+func withVhost(addr string, vhost string) string {
+	u, err := url.Parse(addr)
 	if err != nil {
-		log.Printf("%s %v", logPrefix, fmt.Errorf("build request: %w", err))
+		slog.Warn("Cannot apply RMQ_VHOST to an invalid broker address", "broker_host", urlHost(addr), "error", err)
+		return addr
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Content-Length", fmt.Sprint(len(encoded))) // 선택(대부분 생략 가능)
+	u.Path = "/" + vhost
+	u.RawPath = "/" + url.PathEscape(vhost)
+	return u.String()
+}
 
-	req.Header.Set("X-GitHub-Event", "push") // Jenkins에서 확인하는 꼭 필요한 헤더. 하드코딩!
+// relayExchange returns RELAY_EXCHANGE_<n>, falling back to the global RMQ_EXCHANGE_NAME
+func relayExchange(index int) string {
+	if exchange := relayOwnEnv("RELAY_EXCHANGE", index); exchange != "" {
+		return exchange
+	}
+	return os.Getenv("RMQ_EXCHANGE_NAME")
+}
 
+// relayProxyEnv returns RELAY_PROXY_URL_<n>, falling back to the global HTTP_PROXY_URL
+func relayProxyEnv(index int) string {
+	if proxy := relayOwnSecretEnv("RELAY_PROXY_URL", index); proxy != "" {
+		return proxy
+	}
+	return secretEnv("HTTP_PROXY_URL")
+}
 
-	// 3. Send the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("%s %v", logPrefix, fmt.Errorf("do request: %w", err))
-		return
+// relayShutdownOnPush reads RELAY_SHUTDOWN_ON_PUSH_<n> ("1" or "0"), falling back to the global SHUTDOWN_ON_GITHUB_PUSH
+func relayShutdownOnPush(index int) bool {
+	if shutdown := relayOwnEnv("RELAY_SHUTDOWN_ON_PUSH", index); shutdown != "" {
+		return shutdown == "1"
 	}
+	return os.Getenv("SHUTDOWN_ON_GITHUB_PUSH") == "1"
+}
 
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Printf("%s %v", logPrefix, err)
-		}
-	}(resp.Body)
+// relayDryRun reads RELAY_DRY_RUN_<n> ("1" or "0"), falling back to the global DRY_RUN
+func relayDryRun(index int) bool {
+	if dryRun := relayOwnEnv("RELAY_DRY_RUN", index); dryRun != "" {
+		return dryRun == "1"
+	}
+	return os.Getenv("DRY_RUN") == "1"
+}
 
-	// 4. Quick status-code check
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		log.Printf("%s %v", logPrefix, fmt.Errorf("received non-2xx status: %s", resp.Status))
-		return
+// consumerTagPrefix returns RMQ_CONSUMER_TAG_PREFIX or the default prefix
+func consumerTagPrefix() string {
+	if prefix := os.Getenv("RMQ_CONSUMER_TAG_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return defaultConsumerTagPrefix
+}
+
+// connNameData is what RMQ_CONN_NAME_TEMPLATE can refer to
+type connNameData struct {
+	Host    string // os.Hostname (the pod name on Kubernetes)
+	Index   int
+	RepoKey string
+}
+
+// connNameTemplate parses RMQ_CONN_NAME_TEMPLATE once, warning and using the default when it is invalid
+var connNameTemplate = sync.OnceValue(func() *template.Template {
+	defaultTemplate := template.Must(template.New("RMQ_CONN_NAME_TEMPLATE").Parse(defaultConnNameTemplate))
+	text := os.Getenv("RMQ_CONN_NAME_TEMPLATE")
+	if text == "" {
+		return defaultTemplate
 	}
+	tmpl, err := template.New("RMQ_CONN_NAME_TEMPLATE").Parse(text)
+	if err == nil {
+		// 없는 필드는 실행할 때에야 드러나므로 미리 한 번 실행해 본다.
+		err = tmpl.Execute(io.Discard, connNameData{})
+	}
+	if err != nil {
+		slog.Warn("Invalid RMQ_CONN_NAME_TEMPLATE. Using default.", "error", err, "default", defaultConnNameTemplate)
+		return defaultTemplate
+	}
+	return tmpl
+})
 
-	// 5. Read and print body (discard or parse as needed)
-	body, err := io.ReadAll(resp.Body)
+// connectionName returns the client connection name the broker shows for the relay (RMQ_CONN_NAME_TEMPLATE)
+func connectionName(config RelayConfig) string {
+	host, err := os.Hostname()
 	if err != nil {
-		log.Printf("%s %v", logPrefix, fmt.Errorf("read body: %w", err))
-		return
+		host = "unknown"
+	}
+	var name strings.Builder
+	if err := connNameTemplate().Execute(&name, connNameData{Host: host, Index: config.Index, RepoKey: config.RepoKey}); err != nil {
+		return fmt.Sprintf("github-mq-to-post-relay:%s@%s", config.RepoKey, host)
+	}
+	return name.String()
+}
+
+// normalizeForwardFormat lower-cases FORWARD_FORMAT, defaulting to form.
+// Unsupported values are kept so validateRelayConfig can reject them.
+func normalizeForwardFormat(forwardFormat string) string {
+	if forwardFormat == "" {
+		return forwardFormatForm
 	}
+	return strings.ToLower(forwardFormat)
+}
 
-	log.Printf("%s Server replied (%s):\n%s\n", logPrefix, resp.Status, body)
-}
\ No newline at end of file
+// normalizeLBMode lower-cases RELAY_LB_MODE, defaulting to fanout.
+// Unsupported values are kept so validateRelayConfig can reject them.
+func normalizeLBMode(lbMode string) string {
+	if lbMode == "" {
+		return lbModeFanout
+	}
+	return strings.ToLower(lbMode)
+}
+
+// parseAuthType lower-cases RELAY_AUTH_TYPE, defaulting to none. An unsupported value is kept and
+// returned with an error for validateRelayConfig.
+func parseAuthType(authType string) (string, error) {
+	if authType == "" {
+		return authTypeNone, nil
+	}
+	authType = strings.ToLower(authType)
+	switch authType {
+	case authTypeNone, authTypeBasic, authTypeBearer:
+		return authType, nil
+	default:
+		return authType, fmt.Errorf("unsupported value %q (supported: none, basic, bearer)", authType)
+	}
+}
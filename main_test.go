@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestMain(m *testing.M) {
+	// 실패한 테스트의 출력에 릴레이 로그가 섞이지 않도록 버린다.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// fakeAcknowledger records what consumeRelay did with each delivery, by delivery tag
+type fakeAcknowledger struct {
+	mu       sync.Mutex
+	outcomes map[uint64]string // "ack", "requeue" (nack with requeue), "nack" or "reject"
+}
+
+func newFakeAcknowledger() *fakeAcknowledger {
+	return &fakeAcknowledger{outcomes: map[uint64]string{}}
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	return a.record(tag, "ack")
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		return a.record(tag, "requeue")
+	}
+	return a.record(tag, "nack")
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.record(tag, "reject")
+}
+
+func (a *fakeAcknowledger) record(tag uint64, outcome string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if previous, ok := a.outcomes[tag]; ok {
+		return fmt.Errorf("delivery %d settled twice (%s, then %s)", tag, previous, outcome)
+	}
+	a.outcomes[tag] = outcome
+	return nil
+}
+
+// Outcome returns how the delivery was settled ("" = not at all)
+func (a *fakeAcknowledger) Outcome(tag uint64) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.outcomes[tag]
+}
+
+// delivery returns a push message acknowledged through a
+func (a *fakeAcknowledger) delivery(tag uint64, body string) amqp.Delivery {
+	return amqp.Delivery{
+		Acknowledger: a,
+		DeliveryTag:  tag,
+		RoutingKey:   "MyOrg.my-repo",
+		Headers:      amqp.Table{"X-GitHub-Event": "push", "X-GitHub-Delivery": "delivery-" + strconv.FormatUint(tag, 10)},
+		Body:         []byte(body),
+	}
+}
+
+// fakeChannel is a brokerChannel without a broker. Consume returns deliveries, which the test feeds and closes.
+type fakeChannel struct {
+	deliveries chan amqp.Delivery
+	publishErr error            // returned by PublishWithDeferredConfirmWithContext
+	cancelTag  string           // sent on the NotifyCancel channel as soon as it is registered (broker cancelled the consumer)
+	confirm    fakeConfirmation // the broker's answer to every publish (zero value = ack)
+
+	mu        sync.Mutex
+	calls     []string          // method calls in order, e.g. "Qos 10 0 false"
+	cancels   chan string       // registered by NotifyCancel
+	published []amqp.Publishing // dead-letter publishes
+}
+
+// fakeConfirmation answers a publish: acked unless nacked, or err (e.g. a timeout)
+type fakeConfirmation struct {
+	nacked bool
+	err    error
+}
+
+func newFakeChannel(deliveries ...amqp.Delivery) *fakeChannel {
+	ch := &fakeChannel{deliveries: make(chan amqp.Delivery, len(deliveries))}
+	for _, d := range deliveries {
+		ch.deliveries <- d
+	}
+	return ch
+}
+
+func (c *fakeChannel) record(call string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+}
+
+// Calls returns the recorded method calls in order
+func (c *fakeChannel) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+func (c *fakeChannel) Confirm(noWait bool) error {
+	c.record(fmt.Sprintf("Confirm %t", noWait))
+	return nil
+}
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.record("QueueDeclare " + name)
+	if name == "" {
+		name = "amq.gen-test"
+	}
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.record("QueueDeclarePassive " + name)
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	c.record(fmt.Sprintf("QueueBind %s %s %s", name, key, exchange))
+	return nil
+}
+
+func (c *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	c.record(fmt.Sprintf("Qos %d %d %t", prefetchCount, prefetchSize, global))
+	return nil
+}
+
+func (c *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	c.record(fmt.Sprintf("Consume %s autoAck=%t", queue, autoAck))
+	return c.deliveries, nil
+}
+
+func (c *fakeChannel) Cancel(consumer string, noWait bool) error {
+	c.record("Cancel " + consumer)
+	return nil
+}
+
+func (c *fakeChannel) NotifyCancel(cancels chan string) chan string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancels = cancels
+	if c.cancelTag != "" {
+		cancels <- c.cancelTag
+	}
+	return cancels
+}
+
+func (c *fakeChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (publishConfirmation, error) {
+	c.record(fmt.Sprintf("Publish %s %s", exchange, key))
+	if c.publishErr != nil {
+		return nil, c.publishErr
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, msg)
+	return &pendingConfirmation{channel: c, answer: c.confirm}, nil
+}
+
+// Published returns the messages published so far
+func (c *fakeChannel) Published() []amqp.Publishing {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]amqp.Publishing(nil), c.published...)
+}
+
+// pendingConfirmation records that the publish was waited for
+type pendingConfirmation struct {
+	channel *fakeChannel
+	answer  fakeConfirmation
+}
+
+func (p *pendingConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	p.channel.record("WaitContext")
+	if p.answer.err != nil {
+		return false, p.answer.err
+	}
+	return !p.answer.nacked, nil
+}
+
+// consume runs consumeRelay on ch until it returns, which it does once the test closes the deliveries
+func consume(t *testing.T, ch *fakeChannel, config RelayConfig, client httpDoer) error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	return consumeWithContext(t, ctx, ch, config, client)
+}
+
+func consumeWithContext(t *testing.T, ctx context.Context, ch *fakeChannel, config RelayConfig, client httpDoer) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- consumeRelay(ctx, ch, nil, config, client, nil) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumeRelay did not return")
+		return nil
+	}
+}
+
+// testRelayConfig returns relay 1 forwarding to targetURL with the defaults of newRelayConfig and fast retries
+func testRelayConfig(targetURL string) RelayConfig {
+	config := newRelayConfig(1, "MyOrg.my-repo", targetURL)
+	config.Exchange = "github"
+	config.PostRetryBackoffMs = 1
+	return config
+}
+
+// counterValue reads the relay's value of a counter from the default registry
+func counterValue(t *testing.T, name string, config RelayConfig) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["relay"] == strconv.Itoa(config.Index) && labels["repo_key"] == config.RepoKey {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestConsumeRelaySettlesDeliveries(t *testing.T) {
+	tests := []struct {
+		name         string
+		manualAck    bool
+		statuses     []int
+		configure    func(*RelayConfig)
+		wantOutcome  string
+		wantRequests int
+	}{
+		{name: "forwarded message is acked", manualAck: true, statuses: []int{200}, wantOutcome: "ack", wantRequests: 1},
+		{name: "failed POST is requeued", manualAck: true, statuses: []int{500},
+			configure: func(c *RelayConfig) { c.PostMaxRetries = 0 }, wantOutcome: "requeue", wantRequests: 1},
+		{name: "filtered event is acked without forwarding", manualAck: true,
+			configure: func(c *RelayConfig) { c.EventFilter = []string{"pull_request"} }, wantOutcome: "ack", wantRequests: 0},
+		{name: "filtered branch is acked without forwarding", manualAck: true,
+			configure: func(c *RelayConfig) { c.BranchFilter, _ = parseBranchFilter("release/*") }, wantOutcome: "ack", wantRequests: 0},
+		{name: "auto-ack leaves the delivery alone", manualAck: false, statuses: []int{500},
+			configure: func(c *RelayConfig) { c.PostMaxRetries = 0 }, wantOutcome: "", wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.manualAck {
+				t.Setenv("MANUAL_ACK", "1")
+			} else {
+				t.Setenv("MANUAL_ACK", "")
+			}
+			config := testRelayConfig("http://ci.example.com/github-webhook/")
+			if tt.configure != nil {
+				tt.configure(&config)
+			}
+			client := &fakeDoer{statuses: tt.statuses}
+			acks := newFakeAcknowledger()
+			ch := newFakeChannel(acks.delivery(1, `{"ref":"refs/heads/main"}`))
+			close(ch.deliveries)
+
+			err := consume(t, ch, config, client)
+			if err == nil || err.Error() != "delivery channel closed" {
+				t.Errorf("consumeRelay returned %v, want the delivery channel closed error", err)
+			}
+			if got := acks.Outcome(1); got != tt.wantOutcome {
+				t.Errorf("delivery settled with %q, want %q", got, tt.wantOutcome)
+			}
+			if got := len(client.Requests()); got != tt.wantRequests {
+				t.Errorf("sent %d request(s), want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestConsumeRelayDeclaresAndBindsQueue(t *testing.T) {
+	t.Setenv("MANUAL_ACK", "1")
+	config := testRelayConfig("http://ci.example.com/github-webhook/")
+	config.BindKeys = []string{"MyOrg.my-repo", "MyOrg.other-repo"}
+	ch := newFakeChannel()
+	close(ch.deliveries)
+
+	if err := consume(t, ch, config, &fakeDoer{}); err == nil {
+		t.Fatal("consumeRelay returned nil after the delivery channel closed")
+	}
+	want := []string{
+		"Confirm false",
+		"QueueDeclare ",
+		"QueueBind amq.gen-test MyOrg.my-repo github",
+		"QueueBind amq.gen-test MyOrg.other-repo github",
+		"Qos 10 0 false",
+		"Consume amq.gen-test autoAck=false",
+	}
+	if got := ch.Calls(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("channel calls = %q, want %q", got, want)
+	}
+}
+
+func TestConsumeRelaySetsQosBeforeConsume(t *testing.T) {
+	for _, prefetch := range []int{1, defaultPrefetch, 250} {
+		t.Run(strconv.Itoa(prefetch), func(t *testing.T) {
+			t.Setenv("MANUAL_ACK", "1")
+			config := testRelayConfig("http://ci.example.com/github-webhook/")
+			config.Prefetch = prefetch
+			ch := newFakeChannel()
+			close(ch.deliveries)
+
+			if err := consume(t, ch, config, &fakeDoer{}); err == nil {
+				t.Fatal("consumeRelay returned nil after the delivery channel closed")
+			}
+			// 브로커는 Consume 이후의 Qos를 이미 시작한 컨슈머에 적용하지 않는다.
+			calls := ch.Calls()
+			qos := slices.Index(calls, fmt.Sprintf("Qos %d 0 false", prefetch))
+			consumeCall := slices.IndexFunc(calls, func(call string) bool { return strings.HasPrefix(call, "Consume ") })
+			if qos < 0 || consumeCall < 0 || qos > consumeCall {
+				t.Errorf("channel calls = %q, want Qos(%d, 0, false) before Consume", calls, prefetch)
+			}
+		})
+	}
+}
+
+func TestConsumeRelayDeliveriesClosed(t *testing.T) {
+	tests := []struct {
+		name          string
+		cancelTag     string
+		wantCancelled bool
+	}{
+		{name: "cancelled by the broker", cancelTag: "github-relay:MyOrg.my-repo:1", wantCancelled: true},
+		{name: "closed without a cancel", wantCancelled: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testRelayConfig("http://ci.example.com/github-webhook/")
+			before := counterValue(t, "relay_consumer_cancelled_total", config)
+			// 브로커는 deliveries를 닫기 전에 취소 태그를 보낸다.
+			ch := newFakeChannel()
+			ch.cancelTag = tt.cancelTag
+			close(ch.deliveries)
+
+			// 닫힌 채널을 계속 읽으며 돌지 않고 바로 재접속 루프로 돌아가야 한다 (consume의 시간 제한).
+			err := consume(t, ch, config, &fakeDoer{})
+			if got := errors.Is(err, errConsumerCancelled); got != tt.wantCancelled {
+				t.Errorf("consumeRelay returned %v, want errConsumerCancelled %t", err, tt.wantCancelled)
+			}
+			if !tt.wantCancelled && (err == nil || err.Error() != "delivery channel closed") {
+				t.Errorf("consumeRelay returned %v, want the delivery channel closed error", err)
+			}
+			want := before
+			if tt.wantCancelled {
+				want++
+			}
+			if got := counterValue(t, "relay_consumer_cancelled_total", config); got != want {
+				t.Errorf("relay_consumer_cancelled_total = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// relayManager runs one goroutine per relay and tracks them by repo key, so a configuration reload (SIGHUP)
+// can stop, start or restart single relays while the unchanged ones keep their connections.
+type relayManager struct {
+	ctx                  context.Context // cancelled on shutdown; every relay context derives from it
+	client               httpDoer
+	wg                   *sync.WaitGroup
+	maxReconnectAttempts int    // RMQ_MAX_RECONNECT_ATTEMPTS
+	fatalErrorPolicy     string // RMQ_FATAL_ERROR_POLICY
+
+	mu     sync.Mutex
+	relays map[string]*managedRelay // by repo key
+}
+
+// managedRelay is one relay goroutine started by the manager
+type managedRelay struct {
+	config      RelayConfig
+	fingerprint string
+	cancel      context.CancelFunc
+	done        chan struct{} // closed when the goroutine returned
+	gaveUp      bool          // stopped by RMQ_MAX_RECONNECT_ATTEMPTS or RMQ_FATAL_ERROR_POLICY=stop (guarded by relayManager.mu)
+}
+
+var relays *relayManager
+
+// newRelayManager creates a manager whose relays stop when ctx is cancelled. wg tracks the relay goroutines.
+func newRelayManager(ctx context.Context, client httpDoer, wg *sync.WaitGroup) *relayManager {
+	return &relayManager{
+		ctx:    ctx,
+		client: client,
+		wg:     wg,
+		// RMQ_MAX_RECONNECT_ATTEMPTS: 모든 릴레이가 포기하면 오케스트레이터가 알 수 있도록 0이 아닌 코드로 종료한다.
+		maxReconnectAttempts: envNonNegativeInt("RMQ_MAX_RECONNECT_ATTEMPTS", 0),
+		// RMQ_FATAL_ERROR_POLICY: 인증 실패처럼 재접속해도 소용없는 오류를 어떻게 처리할지
+		fatalErrorPolicy: loadFatalErrorPolicy(),
+		relays:           map[string]*managedRelay{},
+	}
+}
+
+// Start starts a goroutine for each relay
+func (m *relayManager) Start(configs []RelayConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, config := range configs {
+		m.startLocked(config)
+	}
+}
+
+// Configs returns the configurations of the managed relays
+func (m *relayManager) Configs() []RelayConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	configs := make([]RelayConfig, 0, len(m.relays))
+	for _, relay := range m.relays {
+		configs = append(configs, relay.config)
+	}
+	return configs
+}
+
+// Reload applies a new set of relay configurations, matched to the running relays by repo key.
+// Relays missing from configs are stopped, new ones are started, and relays whose configuration changed
+// (or that gave up) are restarted. The others keep running untouched.
+// Stopping a relay works like a shutdown: the message being forwarded is finished first.
+func (m *relayManager) Reload(configs []RelayConfig) (started, stopped, restarted, unchanged int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := map[string]bool{}
+	var stopping []*managedRelay
+	var starting []RelayConfig
+	for _, config := range configs {
+		wanted[config.RepoKey] = true
+		relay, ok := m.relays[config.RepoKey]
+		switch {
+		case !ok:
+			started++
+		case relay.gaveUp || relay.fingerprint != config.fingerprint():
+			restarted++
+			stopping = append(stopping, relay)
+		default:
+			unchanged++
+			continue
+		}
+		starting = append(starting, config)
+	}
+	for repoKey, relay := range m.relays {
+		if !wanted[repoKey] {
+			stopped++
+			stopping = append(stopping, relay)
+		}
+	}
+
+	// 새 설정의 인덱스가 멈출 릴레이의 인덱스와 겹칠 수 있으므로 모두 멈춘 뒤에 시작한다.
+	// 멈추는 릴레이는 relayGaveUp에서 m.mu를 기다리지 않는다 (done을 먼저 닫는다).
+	for _, relay := range stopping {
+		relay.cancel()
+	}
+	for _, relay := range stopping {
+		<-relay.done
+		delete(m.relays, relay.config.RepoKey)
+		relayStates.Unregister(relay.config.Index)
+		replays.Unregister(relay.config.Index)
+		injector.Unregister(relay.config.Index)
+		circuitBreakers.Forget(relay.config)
+	}
+	for _, config := range starting {
+		m.startLocked(config)
+	}
+	return started, stopped, restarted, unchanged
+}
+
+// startLocked starts the goroutine of config. m.mu must be held.
+func (m *relayManager) startLocked(config RelayConfig) {
+	relayStates.Register(config)
+	replays.Register(config)
+	injector.Register(config)
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	relay := &managedRelay{config: config, fingerprint: config.fingerprint(), cancel: cancel, done: make(chan struct{})}
+	m.relays[config.RepoKey] = relay
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		gaveUp := m.run(ctx, config)
+		close(relay.done)
+		if gaveUp {
+			m.relayGaveUp(relay)
+		}
+	}()
+}
+
+// relayGaveUp marks relay as given up and shuts the process down once every relay gave up
+func (m *relayManager) relayGaveUp(relay *managedRelay) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	relay.gaveUp = true
+	if m.relays[relay.config.RepoKey] != relay {
+		// 다시 읽은 설정으로 이미 교체됐다.
+		return
+	}
+	for _, other := range m.relays {
+		if !other.gaveUp {
+			return
+		}
+	}
+	requestShutdown(errAllRelaysGaveUp)
+}
+
+// run keeps the relay consuming, reconnecting with backoff, until ctx is cancelled.
+// Returns true when the relay gave up (RMQ_MAX_RECONNECT_ATTEMPTS, RMQ_FATAL_ERROR_POLICY=stop).
+func (m *relayManager) run(ctx context.Context, cfg RelayConfig) bool {
+	logger := relayLogger(cfg)
+	backoff := loadReconnectBackoff()
+	// 재접속 직후의 재전달을 잡아야 하므로 연결보다 오래 유지한다.
+	dedup := newDedupCache(time.Duration(cfg.DedupTTLSeconds)*time.Second, cfg.DedupSize)
+
+	failures := 0
+	for ctx.Err() == nil {
+		logger.Info("Starting listener...")
+		startedAt := time.Now()
+		err := listenForGitHubPush(ctx, cfg, m.client, dedup)
+		relayStates.SetDisconnected(cfg.Index)
+		if err != nil && ctx.Err() == nil {
+			relayStates.RecordError(cfg.Index, err)
+			// 충분히 오래 연결이 유지됐었다면 처음 간격부터 다시 시작
+			if time.Since(startedAt) >= backoff.ResetAfter {
+				backoff.Reset()
+			}
+
+			fatal := isFatalBrokerError(err, cfg)
+			if fatal && m.fatalErrorPolicy != fatalPolicyRetry {
+				logger.Error("Fatal broker error. Reconnecting cannot fix it; check the credentials, vhost, exchange and queue settings.",
+					"error", err, "policy", m.fatalErrorPolicy)
+				if m.fatalErrorPolicy == fatalPolicyExit {
+					requestShutdown(errFatalBrokerError)
+					return false
+				}
+				return true
+			}
+
+			// 한 번이라도 소비를 시작했으면 연속 실패가 아니다.
+			if relayStates.ConnectedSince(cfg.Index, startedAt) {
+				failures = 0
+			}
+			failures++
+			if m.maxReconnectAttempts > 0 && failures >= m.maxReconnectAttempts {
+				logger.Error("Giving up after consecutive connection failures (RMQ_MAX_RECONNECT_ATTEMPTS)",
+					"error", err, "failures", failures)
+				return true
+			}
+			retryInterval := backoff.Next()
+			logger.Error("Error returned from listenForGitHubPush(). (Check github-org-webhook-center running!) Retrying...",
+				"error", err, "fatal", fatal, "retry_in", retryInterval.String())
+			select {
+			case <-time.After(retryInterval):
+			case <-ctx.Done():
+			}
+		}
+	}
+	logger.Info("Stopped")
+	return false
+}
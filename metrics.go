@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics served on /metrics of the health server.
+// 모든 지표는 릴레이 번호(relay)와 라우팅 키(repo_key)로 구분한다.
+var (
+	messagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_messages_received_total",
+		Help: "Number of messages consumed from RabbitMQ.",
+	}, []string{"relay", "repo_key"})
+
+	postsSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_posts_success_total",
+		Help: "Number of payloads successfully forwarded to the target URL.",
+	}, []string{"relay", "repo_key"})
+
+	postsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_posts_failed_total",
+		Help: "Number of payloads that could not be forwarded to the target URL.",
+	}, []string{"relay", "repo_key"})
+
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "relay_queue_depth",
+		Help: "Messages ready in the relay's named queue, sampled every RMQ_QUEUE_DEPTH_INTERVAL_SECONDS.",
+	}, []string{"relay", "repo_key"})
+
+	circuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "relay_circuit_open",
+		Help: "1 while the target's circuit breaker is open and requests fail fast (RELAY_CIRCUIT_THRESHOLD).",
+	}, []string{"relay", "repo_key", "target_host"})
+
+	consumerCancelled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_consumer_cancelled_total",
+		Help: "Number of times the broker cancelled the relay's consumer (e.g. the queue was deleted).",
+	}, []string{"relay", "repo_key"})
+
+	staleDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_stale_dropped_total",
+		Help: "Number of messages dropped without forwarding because they were older than MAX_MESSAGE_AGE_SECONDS.",
+	}, []string{"relay", "repo_key"})
+
+	backpressureDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_backpressure_dropped_total",
+		Help: "Number of messages dropped because the relay was busy and BACKPRESSURE_BUFFER was full (BACKPRESSURE_MODE=drop-*).",
+	}, []string{"relay", "repo_key"})
+
+	oversizeDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "relay_oversize_dropped_total",
+		Help: "Number of messages dropped (or dead-lettered) without forwarding because they were larger than MAX_PAYLOAD_BYTES.",
+	}, []string{"relay", "repo_key"})
+
+	postDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "relay_post_duration_seconds",
+		Help:    "Time spent forwarding a payload to the target URL.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"relay", "repo_key"})
+)
+
+// relayLabelValues returns the label values identifying config in every metric
+func relayLabelValues(config RelayConfig) []string {
+	return []string{strconv.Itoa(config.Index), config.RepoKey}
+}
+
+// recordPostResult updates the POST counters and duration histogram
+func recordPostResult(config RelayConfig, duration time.Duration, err error) {
+	labels := relayLabelValues(config)
+	postDuration.WithLabelValues(labels...).Observe(duration.Seconds())
+	if err != nil {
+		postsFailed.WithLabelValues(labels...).Inc()
+	} else {
+		postsSucceeded.WithLabelValues(labels...).Inc()
+	}
+}
+
+// recordCircuitState updates the circuit breaker gauge of targetURL
+func recordCircuitState(config RelayConfig, targetURL string, open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	circuitOpen.WithLabelValues(append(relayLabelValues(config), urlHost(targetURL))...).Set(value)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// pauseSwitch is the process-wide "paused" state toggled by SIGUSR1.
+// 일시 정지하면 릴레이는 컨슈머만 취소하고 연결은 유지한다. 이미 받은 메시지는 끝까지 처리한다.
+type pauseSwitch struct {
+	mu      sync.Mutex
+	paused  bool
+	changed chan struct{} // closed and replaced on every toggle
+}
+
+var consumePause = &pauseSwitch{changed: make(chan struct{})}
+
+// State returns the current state and a channel closed at the next toggle
+func (p *pauseSwitch) State() (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused, p.changed
+}
+
+// Toggle flips the state and wakes every relay. Returns the new state.
+func (p *pauseSwitch) Toggle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = !p.paused
+	close(p.changed)
+	p.changed = make(chan struct{})
+	return p.paused
+}
+
+// watchPauseSignal toggles consumePause on every SIGUSR1 until ctx is cancelled.
+// Does nothing on platforms without SIGUSR1 (pauseSignal is nil).
+func watchPauseSignal(ctx context.Context) {
+	if pauseSignal == nil {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, pauseSignal)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				if consumePause.Toggle() {
+					slog.Info("SIGUSR1 received. Pausing all relays after the messages already received.")
+				} else {
+					slog.Info("SIGUSR1 received. Resuming all relays.")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignal toggles pausing of every relay (see watchPauseSignal)
+var pauseSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// pauseSignal is nil because Windows has no SIGUSR1; relays cannot be paused there
+var pauseSignal os.Signal
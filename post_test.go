@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDoer is an httpDoer that records every request and answers with statuses in order (the last one repeats)
+type fakeDoer struct {
+	statuses []int // nil = always 200
+
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+// recordedRequest is a request sent through fakeDoer, with its body read
+type recordedRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   string
+}
+
+func (f *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, recordedRequest{Method: req.Method, URL: req.URL.String(), Header: req.Header.Clone(), Body: string(body)})
+	status := http.StatusOK
+	if len(f.statuses) > 0 {
+		status = f.statuses[min(len(f.requests), len(f.statuses))-1]
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+// Requests returns the requests sent so far
+func (f *fakeDoer) Requests() []recordedRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]recordedRequest(nil), f.requests...)
+}
+
+func hmacHex(newHash func() hash.Hash, secret string, body string) string {
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// formPayload returns the payload field of a form body
+func formPayload(t *testing.T, req recordedRequest) string {
+	values, err := url.ParseQuery(req.Body)
+	if err != nil {
+		t.Fatalf("form body: %v", err)
+	}
+	return values.Get("payload")
+}
+
+// multipartPayload returns the payload.json file part of a multipart body
+func multipartPayload(t *testing.T, req recordedRequest) string {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("content type: %v", err)
+	}
+	part, err := multipart.NewReader(strings.NewReader(req.Body), params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatalf("multipart body: %v", err)
+	}
+	if part.FormName() != "payload" || part.FileName() != multipartFileName {
+		t.Errorf("multipart part is %q (file %q), want payload (file %s)", part.FormName(), part.FileName(), multipartFileName)
+	}
+	data, err := io.ReadAll(part)
+	if err != nil {
+		t.Fatalf("multipart part: %v", err)
+	}
+	return string(data)
+}
+
+func TestPostToUrlFormats(t *testing.T) {
+	const payload = `{"ref":"refs/heads/main","after":"6113728f27ae82c7b1a177c8d03f9e96e0adf246"}`
+	tests := []struct {
+		format          string
+		wantContentType string
+		payload         func(*testing.T, recordedRequest) string
+	}{
+		{forwardFormatForm, "application/x-www-form-urlencoded", formPayload},
+		{forwardFormatJSON, "application/json", func(t *testing.T, req recordedRequest) string { return req.Body }},
+		{forwardFormatMultipart, "multipart/form-data", multipartPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			config := testRelayConfig("http://ci.example.com/github-webhook/")
+			config.ForwardFormat = tt.format
+			config.WebhookSecret = "hub-secret"
+			config.SignHeader, config.SignSecret, config.SignAlgo = "X-Relay-Signature", "relay-secret", "hmac-sha512"
+			client := &fakeDoer{}
+
+			d := newFakeAcknowledger().delivery(1, payload)
+			result := postToUrl(context.Background(), client, d, config)
+			if result.Err != nil {
+				t.Fatalf("postToUrl failed: %v", result.Err)
+			}
+			requests := client.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("sent %d request(s), want 1", len(requests))
+			}
+			req := requests[0]
+
+			if req.Method != http.MethodPost || req.URL != "http://ci.example.com/github-webhook/" {
+				t.Errorf("request is %s %s", req.Method, req.URL)
+			}
+			if got := req.Header.Get("Content-Type"); !strings.HasPrefix(got, tt.wantContentType) {
+				t.Errorf("Content-Type = %q, want %s", got, tt.wantContentType)
+			}
+			if got := tt.payload(t, req); got != payload {
+				t.Errorf("forwarded payload = %q, want %q", got, payload)
+			}
+			if got := req.Header.Get("X-GitHub-Event"); got != "push" {
+				t.Errorf("X-GitHub-Event = %q, want push", got)
+			}
+			if got := req.Header.Get("X-GitHub-Delivery"); got != "delivery-1" {
+				t.Errorf("X-GitHub-Delivery = %q, want delivery-1", got)
+			}
+			// 받는 쪽은 받은 본문 그대로 검증하므로 인코딩한 본문에 서명해야 한다.
+			if got, want := req.Header.Get("X-Hub-Signature-256"), "sha256="+hmacHex(sha256.New, "hub-secret", req.Body); got != want {
+				t.Errorf("X-Hub-Signature-256 = %q, want %q", got, want)
+			}
+			if got, want := req.Header.Get("X-Relay-Signature"), hmacHex(sha512.New, "relay-secret", req.Body); got != want {
+				t.Errorf("X-Relay-Signature = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPostToUrlRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int
+		maxRetries    int
+		wantAttempts  int
+		wantStatus    int
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{name: "5xx is retried until accepted", statuses: []int{503, 502, 200}, maxRetries: 3, wantAttempts: 3, wantStatus: 200},
+		{name: "5xx gives up after POST_MAX_RETRIES", statuses: []int{500}, maxRetries: 2, wantAttempts: 3, wantStatus: 500, wantErr: true},
+		{name: "4xx is not retried", statuses: []int{404, 200}, maxRetries: 3, wantAttempts: 1, wantStatus: 404, wantErr: true, wantPermanent: true},
+		{name: "no retries configured", statuses: []int{503, 200}, maxRetries: 0, wantAttempts: 1, wantStatus: 503, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testRelayConfig("http://ci.example.com/github-webhook/")
+			config.PostMaxRetries = tt.maxRetries
+			client := &fakeDoer{statuses: tt.statuses}
+
+			result := postToUrl(context.Background(), client, newFakeAcknowledger().delivery(1, `{}`), config)
+			if (result.Err != nil) != tt.wantErr {
+				t.Fatalf("postToUrl error = %v, want error %t", result.Err, tt.wantErr)
+			}
+			var permanent errPermanent
+			if got := errors.As(result.Err, &permanent); got != tt.wantPermanent {
+				t.Errorf("postToUrl error = %v, permanent %t, want %t", result.Err, got, tt.wantPermanent)
+			}
+			if result.Attempts != tt.wantAttempts || len(client.Requests()) != tt.wantAttempts {
+				t.Errorf("attempts = %d (%d requests), want %d", result.Attempts, len(client.Requests()), tt.wantAttempts)
+			}
+			if result.StatusCode != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", result.StatusCode, tt.wantStatus)
+			}
+			// 재시도해도 받는 쪽에서 중복을 걸러낼 수 있도록 같은 delivery ID를 보낸다.
+			for _, req := range client.Requests() {
+				if got := req.Header.Get("X-GitHub-Delivery"); got != "delivery-1" {
+					t.Errorf("X-GitHub-Delivery = %q, want delivery-1 on every attempt", got)
+				}
+			}
+		})
+	}
+}
+
+func TestPostToUrlOriginalSignature(t *testing.T) {
+	tests := []struct {
+		format        string
+		wantSignature string
+	}{
+		{forwardFormatJSON, "sha256=original"},
+		// 본문을 바꿔 보내면 원본 서명은 맞지 않으므로 보내지 않는다.
+		{forwardFormatForm, ""},
+		{forwardFormatMultipart, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			config := testRelayConfig("http://ci.example.com/github-webhook/")
+			config.ForwardFormat = tt.format
+			config.ForwardGitHubHeaders = true
+			client := &fakeDoer{}
+
+			d := newFakeAcknowledger().delivery(1, `{}`)
+			d.Headers["X-Hub-Signature-256"] = "sha256=original"
+			d.Headers["X-GitHub-Hook-ID"] = "42"
+			if result := postToUrl(context.Background(), client, d, config); result.Err != nil {
+				t.Fatalf("postToUrl failed: %v", result.Err)
+			}
+			req := client.Requests()[0]
+			if got := req.Header.Get("X-Hub-Signature-256"); got != tt.wantSignature {
+				t.Errorf("X-Hub-Signature-256 = %q, want %q", got, tt.wantSignature)
+			}
+			if got := req.Header.Get("X-GitHub-Hook-ID"); got != "42" {
+				t.Errorf("X-GitHub-Hook-ID = %q, want 42", got)
+			}
+		})
+	}
+}
+
+func TestPostToUrlRoundRobinAccepted(t *testing.T) {
+	config := testRelayConfig("http://a.example.com/hook")
+	config.TargetURLs = []string{"http://a.example.com/hook", "http://b.example.com/hook"}
+	config.LBMode = lbModeRoundRobin
+	client := &fakeDoer{}
+
+	// 감사 로그에는 실제로 받은 대상만 남아야 한다.
+	for i, want := range []string{"http://a.example.com/hook", "http://b.example.com/hook"} {
+		result := postToUrl(context.Background(), client, newFakeAcknowledger().delivery(uint64(i+1), `{}`), config)
+		if result.Err != nil {
+			t.Fatalf("postToUrl failed: %v", result.Err)
+		}
+		if len(result.Accepted) != 1 || result.Accepted[0] != want {
+			t.Errorf("message %d accepted by %v, want [%s]", i+1, result.Accepted, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// queryMapping sets one query parameter from a JSON path of the payload (RELAY_QUERY_MAP)
+type queryMapping struct {
+	Param string
+	Path  string // as configured, e.g. "$.head_commit.id"
+	steps []any  // object keys (string) and array indices (int)
+}
+
+// parseQueryMap parses "branch=$.ref,sha=$.after" into mappings
+func parseQueryMap(str string) ([]queryMapping, error) {
+	var mappings []queryMapping
+	for _, item := range splitList(str) {
+		param, path, ok := strings.Cut(item, "=")
+		param, path = strings.TrimSpace(param), strings.TrimSpace(path)
+		if !ok || param == "" || path == "" {
+			return nil, fmt.Errorf("invalid entry %q (expected param=$.path)", item)
+		}
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", param, err)
+		}
+		mappings = append(mappings, queryMapping{Param: param, Path: path, steps: steps})
+	}
+	return mappings, nil
+}
+
+// parseJSONPath parses a minimal JSON path: "$" followed by ".key" and "[index]" steps.
+// The leading "$." may be omitted ("head_commit.id").
+func parseJSONPath(path string) ([]any, error) {
+	rest := strings.TrimPrefix(path, "$")
+	if rest != path && rest != "" && rest[0] != '.' && rest[0] != '[' {
+		return nil, fmt.Errorf("invalid JSON path %q", path)
+	}
+	if rest == path {
+		rest = "." + rest
+	}
+
+	var steps []any
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: empty key", path)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: missing ]", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: array index must be a non-negative integer", path)
+			}
+			steps = append(steps, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+	return steps, nil
+}
+
+// lookup returns the value at the path in the decoded payload, or false when a step is missing or null
+func (m queryMapping) lookup(value any) (any, bool) {
+	for _, step := range m.steps {
+		switch step := step.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			value = object[step]
+		case int:
+			array, ok := value.([]any)
+			if !ok || step >= len(array) {
+				return nil, false
+			}
+			value = array[step]
+		}
+	}
+	return value, value != nil
+}
+
+// queryFromPayload builds the RELAY_QUERY_MAP query string from the JSON payload.
+// Missing (or null) fields are left out and returned in missing. Strings, numbers and booleans are
+// used as they are, objects and arrays as compact JSON.
+func queryFromPayload(mappings []queryMapping, payload []byte) (query string, missing []string, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber() // 커밋 시간 같은 큰 숫자가 지수 표기로 바뀌지 않도록
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return "", nil, fmt.Errorf("payload is not JSON: %w", err)
+	}
+
+	values := url.Values{}
+	for _, m := range mappings {
+		value, ok := m.lookup(root)
+		if !ok {
+			missing = append(missing, m.Path)
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			values.Add(m.Param, value)
+		case json.Number:
+			values.Add(m.Param, value.String())
+		case bool:
+			values.Add(m.Param, strconv.FormatBool(value))
+		default:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return "", nil, err
+			}
+			values.Add(m.Param, string(encoded))
+		}
+	}
+	return values.Encode(), missing, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// processEnvKeys are the variables set before .env was loaded. They win over .env, also on reload.
+var processEnvKeys map[string]bool
+
+// dotenvKeys are the variables the last load of .env set
+var dotenvKeys map[string]bool
+
+// loadDotenv loads .env like godotenv.Load (existing variables are not overridden) and remembers
+// which variables came from it, so reloadDotenv can apply edits to the file.
+func loadDotenv() error {
+	processEnvKeys = map[string]bool{}
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		processEnvKeys[name] = true
+	}
+	dotenvKeys = map[string]bool{}
+	return reloadDotenv()
+}
+
+// reloadDotenv sets the variables of .env that are not in the process environment and
+// unsets the ones removed from .env since the last load
+func reloadDotenv() error {
+	values, err := godotenv.Read()
+	if err != nil {
+		return err
+	}
+	for name := range dotenvKeys {
+		if _, ok := values[name]; !ok {
+			os.Unsetenv(name)
+			delete(dotenvKeys, name)
+		}
+	}
+	for name, value := range values {
+		if processEnvKeys[name] {
+			continue
+		}
+		os.Setenv(name, value)
+		dotenvKeys[name] = true
+	}
+	return nil
+}
+
+// fingerprint identifies everything that affects how the relay runs.
+// A reload restarts the relay only when its fingerprint changed.
+func (c RelayConfig) fingerprint() string {
+	// 포인터나 비공개 필드만 있는 값은 JSON으로 비교할 수 없으므로 원본 문자열로 따로 넣는다.
+	comparable := c
+	comparable.Template, comparable.ProxyURL, comparable.BranchFilter = nil, nil, nil
+	comparable.rotation, comparable.client = nil, nil
+	data, err := json.Marshal(comparable)
+	if err != nil {
+		// 비교할 수 없으면 항상 바뀐 것으로 본다.
+		return ""
+	}
+
+	parts := []string{string(data), c.clientSettings}
+	if c.Template != nil && c.Template.Tree != nil {
+		parts = append(parts, c.Template.Root.String())
+	}
+	if c.ProxyURL != nil {
+		parts = append(parts, c.ProxyURL.String())
+	}
+	for _, pattern := range c.BranchFilter {
+		parts = append(parts, pattern.String())
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// watchReloadSignal re-reads .env and the relay configuration on every SIGHUP until ctx is cancelled.
+// Does nothing on platforms without SIGHUP (reloadSignal is nil).
+// 설정이 잘못됐으면 실행 중인 릴레이를 그대로 두고 오류만 남긴다.
+func watchReloadSignal(ctx context.Context) {
+	if reloadSignal == nil {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, reloadSignal)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				reloadRelayConfigs()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reloadRelayConfigs applies the current configuration to the running relays (see relayManager.Reload)
+func reloadRelayConfigs() {
+	slog.Info("SIGHUP received. Reloading relay configuration...")
+	if err := reloadDotenv(); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Error reloading .env file", "error", err)
+	}
+
+	configs, err := loadRelayConfigs()
+	if err == nil {
+		logEffectiveConfig(configs)
+		configs, err = enabledRelays(configs)
+	}
+	if err != nil {
+		slog.Error("Reloading relay configuration failed. Keeping the running relays.", "error", err)
+		return
+	}
+
+	started, stopped, restarted, unchanged := relays.Reload(configs)
+	slog.Info("Reloaded relay configuration", "started", started, "stopped", stopped, "restarted", restarted, "unchanged", unchanged)
+}
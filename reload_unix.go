@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignal re-reads the relay configuration (see watchReloadSignal)
+var reloadSignal os.Signal = syscall.SIGHUP
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reloadSignal is nil because Windows has no SIGHUP; changing the configuration needs a restart there
+var reloadSignal os.Signal
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultReplayBufferSize is how many recent payloads each relay keeps for /replay (REPLAY_BUFFER_SIZE)
+const defaultReplayBufferSize = 20
+
+// replayRing keeps the last forwarded deliveries of one relay, oldest first
+type replayRing struct {
+	config     RelayConfig
+	deliveries []amqp.Delivery
+}
+
+// replayStore backs the /replay admin endpoint. It is nil unless REPLAY_TOKEN is set.
+// 배포 실패로 놓친 웹훅을 개발자가 다시 푸시하지 않아도 다시 보낼 수 있게 한다.
+type replayStore struct {
+	token  string
+	size   int
+	client httpDoer
+
+	mu    sync.Mutex
+	rings map[int]*replayRing
+}
+
+var replays *replayStore
+
+// newReplayStore creates the store, or returns nil when REPLAY_TOKEN is not set. Relays are added with Register.
+func newReplayStore(client httpDoer) *replayStore {
+	token := secretEnv("REPLAY_TOKEN")
+	if token == "" {
+		return nil
+	}
+	return &replayStore{
+		token:  token,
+		size:   envPositiveInt("REPLAY_BUFFER_SIZE", defaultReplayBufferSize),
+		client: client,
+		rings:  map[int]*replayRing{},
+	}
+}
+
+// Register creates an empty buffer for the relay, replacing the previous one after a configuration reload
+func (s *replayStore) Register(config RelayConfig) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rings[config.Index] = &replayRing{config: config}
+}
+
+// Unregister drops the buffer of a relay stopped by a configuration reload
+func (s *replayStore) Unregister(index int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rings, index)
+}
+
+// Remember keeps d as one of the relay's recent payloads, dropping the oldest beyond REPLAY_BUFFER_SIZE
+func (s *replayStore) Remember(index int, d amqp.Delivery) {
+	if s == nil {
+		return
+	}
+	// ack/nack는 원래 채널에서만 할 수 있으므로 떼어 둔다.
+	d.Acknowledger = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring, ok := s.rings[index]
+	if !ok {
+		return
+	}
+	ring.deliveries = append(ring.deliveries, d)
+	if len(ring.deliveries) > s.size {
+		ring.deliveries = ring.deliveries[len(ring.deliveries)-s.size:]
+	}
+}
+
+// recent returns the relay's config and its last count deliveries, oldest first
+func (s *replayStore) recent(index int, count int) (RelayConfig, []amqp.Delivery, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ring, ok := s.rings[index]
+	if !ok {
+		return RelayConfig{}, nil, false
+	}
+	if count > len(ring.deliveries) {
+		count = len(ring.deliveries)
+	}
+	return ring.config, append([]amqp.Delivery(nil), ring.deliveries[len(ring.deliveries)-count:]...), true
+}
+
+// adminPostResult describes one payload forwarded by /replay or /inject
+type adminPostResult struct {
+	CorrelationID string `json:"correlation_id"`
+	RoutingKey    string `json:"routing_key"`
+	StatusCode    int    `json:"status_code"`
+	Attempts      int    `json:"attempts"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ServeHTTP handles POST /replay?relay=<index>&count=<n> (count defaults to 1).
+// Requires "Authorization: Bearer <REPLAY_TOKEN>". Payloads are re-sent oldest first, bypassing RELAY_DEDUP_TTL_SECONDS.
+func (s *replayStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !bearerAuthorized(r, s.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	index, err := strconv.Atoi(r.URL.Query().Get("relay"))
+	if err != nil {
+		http.Error(w, "relay must be a relay index", http.StatusBadRequest)
+		return
+	}
+	count := 1
+	if str := r.URL.Query().Get("count"); str != "" {
+		if count, err = strconv.Atoi(str); err != nil || count <= 0 {
+			http.Error(w, "count must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	config, deliveries, ok := s.recent(index, count)
+	if !ok {
+		http.Error(w, "unknown relay", http.StatusNotFound)
+		return
+	}
+
+	logger := relayLogger(config)
+	logger.Warn("Replaying recent payloads", "requested", count, "available", len(deliveries), "remote_addr", r.RemoteAddr)
+	results := make([]adminPostResult, 0, len(deliveries))
+	for _, d := range deliveries {
+		correlationID := newCorrelationID()
+		ctx, span := startDeliverySpan(withCorrelationID(inFlightCtx, correlationID), d, config)
+		result := postToUrl(ctx, s.client, d, config)
+		endSpan(span, result.Err)
+
+		entry := adminPostResult{CorrelationID: correlationID, RoutingKey: d.RoutingKey, StatusCode: result.StatusCode, Attempts: result.Attempts}
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+			logger.Error("Replay failed", "correlation_id", correlationID, "error", result.Err, "duration", result.Duration.String())
+		} else {
+			logger.Info("Replayed", "correlation_id", correlationID, "status_code", result.StatusCode, "duration", result.Duration.String())
+		}
+		results = append(results, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		slog.Warn("Writing /replay response failed", "error", err)
+	}
+}
+
+// bearerAuthorized reports whether the request carries "Authorization: Bearer <token>"
+func bearerAuthorized(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminEndpointsRequireBearerToken(t *testing.T) {
+	t.Setenv("REPLAY_TOKEN", "admin-token")
+	t.Setenv("INJECT_TOKEN", "admin-token")
+	handlers := map[string]http.Handler{
+		"/replay": newReplayStore(&fakeDoer{}),
+		"/inject": newInjectHandler(&fakeDoer{}),
+	}
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		// 인증을 통과하면 relay 파라미터가 없어 400이 된다.
+		{name: "bearer token", authorization: "Bearer admin-token", wantStatus: http.StatusBadRequest},
+		{name: "no header", authorization: "", wantStatus: http.StatusUnauthorized},
+		{name: "missing scheme", authorization: "admin-token", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", authorization: "Basic admin-token", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer other-token", wantStatus: http.StatusUnauthorized},
+	}
+	for path, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				if tt.authorization != "" {
+					req.Header.Set("Authorization", tt.authorization)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+				}
+			})
+		}
+	}
+}
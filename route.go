@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// targetRoute sends messages whose routing key matches Pattern to TargetURLs (RELAY_ROUTES).
+// 패턴은 topic 바인딩과 같은 규칙이다: `*` = 한 단어, `#` = 0개 이상의 단어 (단어는 점으로 구분).
+type targetRoute struct {
+	Pattern    string
+	TargetURLs []string
+}
+
+// parseRoutes parses "pattern=url[,url...];pattern2=url" into routes, keeping their order
+func parseRoutes(str string) ([]targetRoute, error) {
+	var routes []targetRoute
+	for _, entry := range strings.Split(str, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, urls, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q (expected pattern=url[,url...])", entry)
+		}
+		route, err := newTargetRoute(pattern, splitList(urls))
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// newTargetRoute checks the pattern and target URLs of one route
+func newTargetRoute(pattern string, targetURLs []string) (targetRoute, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || len(targetURLs) == 0 {
+		return targetRoute{}, fmt.Errorf("route %q needs a pattern and at least one target URL", pattern)
+	}
+	if err := validateRoutingKey(pattern, exchangeTypeTopic); err != nil {
+		return targetRoute{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return targetRoute{Pattern: pattern, TargetURLs: targetURLs}, nil
+}
+
+// topicMatches reports whether routingKey matches the topic pattern
+func topicMatches(pattern string, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern []string, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		// 0개부터 남은 단어 전부까지 삼켜 본다
+		for skip := 0; skip <= len(words); skip++ {
+			if matchWords(pattern[1:], words[skip:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+	}
+}
+
+// targetsFor returns the target URLs of the first route matching routingKey,
+// or TargetURLs (RELAY_TARGET_URL) when no route matches.
+func (c RelayConfig) targetsFor(routingKey string) []string {
+	for _, route := range c.Routes {
+		if topicMatches(route.Pattern, routingKey) {
+			return route.TargetURLs
+		}
+	}
+	return c.TargetURLs
+}
+
+// allTargetURLs returns TargetURLs followed by the target URLs of every route
+func (c RelayConfig) allTargetURLs() []string {
+	urls := append([]string(nil), c.TargetURLs...)
+	for _, route := range c.Routes {
+		urls = append(urls, route.TargetURLs...)
+	}
+	return urls
+}
+
+// Placeholders substituted in target URLs for each message, e.g. https://ci/build/{{.RepoKey}}
+const (
+	placeholderRepoKey    = "{{.RepoKey}}"    // the relay's repo key (DIRECT_EXCHANGE_REPO_KEY)
+	placeholderRoutingKey = "{{.RoutingKey}}" // the message's routing key (differs from RepoKey with topic patterns or RELAY_REPO_KEYS)
+)
+
+// expandTargetURL substitutes the placeholders of targetURL. Each value is escaped as a single path segment,
+// so a repo key like "MyOrg/MyRepo" becomes "MyOrg%2FMyRepo".
+// 대상마다 릴레이를 따로 두지 않고, 경로로 잡을 구분하는 빌드 서버 하나로 보낼 수 있다.
+func expandTargetURL(targetURL string, repoKey string, routingKey string) string {
+	if !strings.Contains(targetURL, "{{") {
+		return targetURL
+	}
+	return strings.NewReplacer(
+		placeholderRepoKey, url.PathEscape(repoKey),
+		placeholderRoutingKey, url.PathEscape(routingKey),
+	).Replace(targetURL)
+}
+
+// expandedTargetsFor returns targetsFor(routingKey) with the placeholders substituted for the message
+func (c RelayConfig) expandedTargetsFor(routingKey string) []string {
+	targets := c.targetsFor(routingKey)
+	expanded := make([]string, len(targets))
+	for i, targetURL := range targets {
+		expanded[i] = expandTargetURL(targetURL, c.RepoKey, routingKey)
+	}
+	return expanded
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// checkTargets sends a HEAD request to every target URL of the relays and logs whether it answered
+// (STARTUP_HEALTHCHECK=1). Any response counts as reachable, since a target may legitimately reject HEAD;
+// only connection errors and timeouts are warnings. Nothing is fatal. Relays in dry-run mode are skipped.
+// 실제 푸시가 오기 전에 잘못된 주소, DNS, 방화벽, TLS 설정을 바로 알 수 있게 한다.
+func checkTargets(ctx context.Context, client httpDoer, configs []RelayConfig) {
+	var wg sync.WaitGroup
+	for _, config := range configs {
+		if config.DryRun {
+			relayLogger(config).Info("Dry run. Skipping the startup target check.")
+			continue
+		}
+		var checked []string
+		for _, targetURL := range config.allTargetURLs() {
+			targetURL = expandTargetURL(targetURL, config.RepoKey, config.RepoKey)
+			if slices.Contains(checked, targetURL) {
+				continue
+			}
+			checked = append(checked, targetURL)
+
+			wg.Add(1)
+			go func(config RelayConfig, targetURL string) {
+				defer wg.Done()
+				checkTarget(ctx, client, config, targetURL)
+			}(config, targetURL)
+		}
+	}
+	wg.Wait()
+}
+
+// checkTarget sends one HEAD request with the relay's client, proxy, timeout and Host header
+func checkTarget(ctx context.Context, client httpDoer, config RelayConfig, targetURL string) {
+	logger := relayLogger(config).With("target_url", redactURL(targetURL))
+	if config.client != nil {
+		client = config.client
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.TimeoutSeconds)*time.Second)
+	defer cancel()
+	if config.ProxyURL != nil {
+		ctx = withProxy(ctx, config.ProxyURL)
+	}
+	// 리다이렉트를 따라가지 않고 첫 응답만 본다.
+	ctx = withSuccessCodes(ctx, statusCodeSet{{Min: 300, Max: 399}})
+
+	requestURL := targetURL
+	if isUnixTarget(targetURL) {
+		requestURL = unixRequestURL(targetURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, requestURL, nil)
+	if err != nil {
+		logger.Warn("Startup check: invalid target URL", "error", err)
+		return
+	}
+	req.Header.Set("User-Agent", config.UserAgent)
+	if config.HostHeader != "" {
+		req.Host = config.HostHeader
+	}
+
+	startedAt := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		// url.Error에는 전체 URL이 들어 있다.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactURL(urlErr.URL)
+		}
+		logger.Warn("Startup check: target unreachable", "error", err, "duration", time.Since(startedAt).String())
+		return
+	}
+	resp.Body.Close()
+	logger.Info("Startup check: target reachable", "status_code", resp.StatusCode, "duration", time.Since(startedAt).String())
+}
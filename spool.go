@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// spoolEntry is a webhook that could not be delivered, saved as one JSON file in SPOOL_DIR
+type spoolEntry struct {
+	RelayIndex  int               `json:"relay_index"`
+	RepoKey     string            `json:"repo_key"`
+	RoutingKey  string            `json:"routing_key"`
+	Headers     map[string]string `json:"headers"` // string-valued AMQP headers (X-GitHub-Event, X-GitHub-Delivery, ...)
+	ContentType string            `json:"content_type"`
+	Body        []byte            `json:"body"`
+	SpooledAt   time.Time         `json:"spooled_at"`
+}
+
+// payloadSpool buffers undeliverable webhooks on local disk and retries them in order.
+// 파일 이름이 "<저장 시각(ns)>-<릴레이 번호>.json"이라 이름순이 곧 저장 순서다.
+type payloadSpool struct {
+	dir      string
+	maxBytes int64
+	mu       sync.Mutex
+}
+
+// spool is nil unless SPOOL_DIR is set
+var spool *payloadSpool
+
+// newPayloadSpool creates the spool directory. maxBytes caps the total size of spooled files.
+func newPayloadSpool(dir string, maxBytes int64) (*payloadSpool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &payloadSpool{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// Save writes the delivery to disk. Fails when the spool would exceed SPOOL_MAX_BYTES.
+func (s *payloadSpool) Save(d amqp.Delivery, config RelayConfig) error {
+	entry := spoolEntry{
+		RelayIndex:  config.Index,
+		RepoKey:     config.RepoKey,
+		RoutingKey:  d.RoutingKey,
+		Headers:     map[string]string{},
+		ContentType: d.ContentType,
+		Body:        d.Body,
+		SpooledAt:   time.Now(),
+	}
+	for k := range d.Headers {
+		if v := deliveryHeader(d, k); v != "" {
+			entry.Headers[k] = v
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used, err := s.usedBytes()
+	if err != nil {
+		return err
+	}
+	if used+int64(len(data)) > s.maxBytes {
+		return fmt.Errorf("spool is full (%d of %d bytes used)", used, s.maxBytes)
+	}
+
+	name := fmt.Sprintf("%020d-%d.json", entry.SpooledAt.UnixNano(), config.Index)
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	// 쓰다 만 파일을 재전송하지 않도록 rename으로 완성
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+// usedBytes returns the total size of the spooled files
+func (s *payloadSpool) usedBytes() (int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// files returns the spooled file names in the order they were saved
+func (s *payloadSpool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Run retries spooled webhooks every interval until ctx is cancelled.
+// configs returns the running relays; it is called every round so reloaded configurations are used.
+func (s *payloadSpool) Run(ctx context.Context, interval time.Duration, client httpDoer, configs func() []RelayConfig) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retry(ctx, client, configs())
+		}
+	}
+}
+
+// retry re-sends spooled webhooks in order. After a failure the remaining entries of that relay
+// wait for the next round so they are not delivered out of order.
+// Stops between entries once ctx is cancelled; the entry being sent may finish within the grace period.
+func (s *payloadSpool) retry(ctx context.Context, client httpDoer, configs []RelayConfig) {
+	names, err := s.files()
+	if err != nil {
+		slog.Error("Reading spool directory failed", "dir", s.dir, "error", err)
+		return
+	}
+
+	configsByIndex := map[int]RelayConfig{}
+	for _, config := range configs {
+		configsByIndex[config.Index] = config
+	}
+	blocked := map[int]bool{}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		path := filepath.Join(s.dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("Reading spooled webhook failed", "file", path, "error", err)
+			continue
+		}
+		var entry spoolEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			slog.Error("Spooled webhook is corrupt. Skipped.", "file", path, "error", err)
+			continue
+		}
+		if blocked[entry.RelayIndex] {
+			continue
+		}
+
+		config, ok := configsByIndex[entry.RelayIndex]
+		if !ok || config.RepoKey != entry.RepoKey {
+			slog.Warn("No matching relay for spooled webhook. Kept.", "file", path, "relay_index", entry.RelayIndex, "repo_key", entry.RepoKey)
+			continue
+		}
+
+		correlationID := newCorrelationID()
+		logger := relayLogger(config).With("spool_file", name, "correlation_id", correlationID)
+		if err := postToUrl(withCorrelationID(inFlightCtx, correlationID), client, entry.delivery(), config).Err; err != nil {
+			logger.Warn("Retrying spooled webhook failed", "error", err)
+			blocked[entry.RelayIndex] = true
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			logger.Error("Removing delivered spool file failed", "error", err)
+			continue
+		}
+		logger.Info("Delivered spooled webhook", "spooled_at", entry.SpooledAt)
+	}
+}
+
+// delivery rebuilds the AMQP delivery passed to postToUrl
+func (e spoolEntry) delivery() amqp.Delivery {
+	headers := amqp.Table{}
+	for k, v := range e.Headers {
+		headers[k] = v
+	}
+	return amqp.Delivery{
+		RoutingKey:  e.RoutingKey,
+		Headers:     headers,
+		ContentType: e.ContentType,
+		Body:        e.Body,
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// statusCodeRange is an inclusive range of HTTP status codes
+type statusCodeRange struct {
+	Min, Max int
+}
+
+// statusCodeSet holds the status codes a target may answer with on success (RELAY_SUCCESS_CODES).
+// nil means the default, 2xx only.
+type statusCodeSet []statusCodeRange
+
+// parseStatusCodes parses "200-299,302" into a set. An empty string returns nil (2xx).
+func parseStatusCodes(str string) (statusCodeSet, error) {
+	var codes statusCodeSet
+	for _, item := range splitList(str) {
+		lowStr, highStr, isRange := strings.Cut(item, "-")
+		if !isRange {
+			highStr = lowStr
+		}
+		low, lowErr := strconv.Atoi(strings.TrimSpace(lowStr))
+		high, highErr := strconv.Atoi(strings.TrimSpace(highStr))
+		if lowErr != nil || highErr != nil || low < 100 || high > 599 || low > high {
+			return nil, fmt.Errorf("invalid status code or range %q (expected e.g. 200-299,302)", item)
+		}
+		codes = append(codes, statusCodeRange{Min: low, Max: high})
+	}
+	return codes, nil
+}
+
+// Contains reports whether code counts as success
+func (s statusCodeSet) Contains(code int) bool {
+	if s == nil {
+		return code >= 200 && code < 300
+	}
+	for _, r := range s {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+func (s statusCodeSet) String() string {
+	if s == nil {
+		return "2xx"
+	}
+	items := make([]string, len(s))
+	for i, r := range s {
+		items[i] = strconv.Itoa(r.Min)
+		if r.Max != r.Min {
+			items[i] += "-" + strconv.Itoa(r.Max)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+type successCodesContextKey struct{}
+
+// withSuccessCodes makes checkRedirect keep a redirect response whose status is in codes
+func withSuccessCodes(ctx context.Context, codes statusCodeSet) context.Context {
+	return context.WithValue(ctx, successCodesContextKey{}, codes)
+}
+
+// checkRedirect is the CheckRedirect of the forward clients. A redirect listed in RELAY_SUCCESS_CODES
+// (e.g. 302) is returned as the response instead of being followed, otherwise it behaves like the default policy.
+// 따라가면 POST가 GET으로 바뀌어 받는 쪽의 리다이렉트 대상 페이지에서 실패하기 쉽다.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if codes, ok := req.Context().Value(successCodesContextKey{}).(statusCodeSet); ok && req.Response != nil && codes.Contains(req.Response.StatusCode) {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are available in RELAY_TEMPLATE in addition to the text/template builtins
+var templateFuncs = template.FuncMap{
+	// json은 값을 JSON으로 인코딩한다. 문자열의 따옴표/이스케이프를 템플릿에서 직접 처리하지 않아도 된다.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// loadPayloadTemplate parses RELAY_TEMPLATE_<n> (else RELAY_TEMPLATE). A value containing "{{" is an
+// inline template, anything else is the path of a template file. Returns nil when unset.
+func loadPayloadTemplate(index int) (*template.Template, error) {
+	str := relayEnv("RELAY_TEMPLATE", index)
+	if str == "" {
+		return nil, nil
+	}
+
+	text := str
+	if !strings.Contains(str, "{{") {
+		b, err := os.ReadFile(str)
+		if err != nil {
+			return nil, fmt.Errorf("read template file: %w", err)
+		}
+		text = string(b)
+	}
+
+	// 없는 필드는 빈 값이 아니라 오류로 처리해 잘못된 본문을 보내지 않는다.
+	return template.New("RELAY_TEMPLATE").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// renderPayload applies tmpl to the parsed GitHub payload and returns the reshaped body.
+// Numbers keep their original text so large IDs are not rounded.
+func renderPayload(tmpl *template.Template, payload []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
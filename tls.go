@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// buildTLSConfig creates a tls.Config presenting the certFile/keyFile pair if given.
+// When caFile is set, only that CA is trusted instead of the system roots.
+func buildTLSConfig(caFile string, certFile string, keyFile string, skipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipVerify, // 개발 환경용
+	}
+
+	if caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("both client certificate and key files must be set")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// loadRMQTLSConfig builds the TLS settings for amqps:// connections from
+// RMQ_TLS_CA_FILE, RMQ_TLS_CERT_FILE, RMQ_TLS_KEY_FILE and RMQ_TLS_SKIP_VERIFY.
+func loadRMQTLSConfig() (*tls.Config, error) {
+	return buildTLSConfig(
+		os.Getenv("RMQ_TLS_CA_FILE"),
+		os.Getenv("RMQ_TLS_CERT_FILE"),
+		os.Getenv("RMQ_TLS_KEY_FILE"),
+		os.Getenv("RMQ_TLS_SKIP_VERIFY") == "1",
+	)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"os"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the relay spans. Until setupTracing installs an exporter
+// the global provider is a no-op, so spans cost next to nothing.
+var tracer = otel.Tracer("github-mq-to-post-relay")
+
+// setupTracing exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) is set. The exporter reads the other standard
+// OTEL_* variables itself. Returns a function flushing pending spans on shutdown.
+func setupTracing(ctx context.Context) func(context.Context) error {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		slog.Error("Creating OTLP trace exporter failed. Tracing disabled.", "error", err)
+		return func(context.Context) error { return nil }
+	}
+
+	if os.Getenv("OTEL_SERVICE_NAME") == "" {
+		_ = os.Setenv("OTEL_SERVICE_NAME", "github-mq-to-post-relay")
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	slog.Info("OpenTelemetry tracing enabled")
+	return provider.Shutdown
+}
+
+// amqpHeaderCarrier lets the propagator read trace context (traceparent, ...) from AMQP headers
+type amqpHeaderCarrier amqp.Table
+
+func (c amqpHeaderCarrier) Get(key string) string {
+	if v, ok := c[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (c amqpHeaderCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c amqpHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startDeliverySpan starts the span covering one consumed message under parent, continuing the trace
+// the webhook center put into the message headers, if any.
+func startDeliverySpan(parent context.Context, d amqp.Delivery, config RelayConfig) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(parent, amqpHeaderCarrier(d.Headers))
+	return tracer.Start(ctx, "relay "+config.RepoKey,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(relayAttributes(config)...),
+	)
+}
+
+// relayAttributes identifies the relay on every span
+func relayAttributes(config RelayConfig) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("relay.index", config.Index),
+		attribute.String("relay.repo_key", config.RepoKey),
+	}
+}
+
+// startPostSpan starts the child span of a single POST attempt to targetURL
+func startPostSpan(ctx context.Context, config RelayConfig, targetURL string, attempt int) (context.Context, trace.Span) {
+	host := targetURL
+	if u, err := url.Parse(targetURL); err == nil {
+		host = u.Host
+	}
+	attrs := append(relayAttributes(config),
+		attribute.String("server.address", host),
+		attribute.Int("relay.post.attempt", attempt),
+	)
+	return tracer.Start(ctx, config.Method+" "+host,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endSpan records err on the span (if any) and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
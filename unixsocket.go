@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// unixSocketHostSuffix marks the placeholder hosts of unix:// targets.
+// 소켓마다 다른 호스트 이름을 써야 커넥션 풀에서 다른 소켓의 연결을 재사용하지 않는다.
+const unixSocketHostSuffix = ".unix-socket.invalid"
+
+// unixSockets maps placeholder hosts to socket paths, registered by unixRequestURL
+var unixSockets sync.Map
+
+// isUnixTarget reports whether targetURL is a unix:// socket target
+func isUnixTarget(targetURL string) bool {
+	return strings.HasPrefix(strings.ToLower(targetURL), "unix://")
+}
+
+// splitUnixTarget splits "unix:///path/to.sock:/request/path?query" into the socket path and
+// the request path (default "/").
+func splitUnixTarget(targetURL string) (socketPath string, requestPath string) {
+	rest := targetURL[len("unix://"):]
+	socketPath, requestPath, found := strings.Cut(rest, ":")
+	if !found || requestPath == "" {
+		requestPath = "/"
+	}
+	if !strings.HasPrefix(requestPath, "/") {
+		requestPath = "/" + requestPath
+	}
+	return socketPath, requestPath
+}
+
+// unixRequestURL rewrites a unix:// target into an http:// URL whose placeholder host
+// dialUnixOrTCP resolves back to the socket.
+func unixRequestURL(targetURL string) string {
+	socketPath, requestPath := splitUnixTarget(targetURL)
+	sum := sha256.Sum256([]byte(socketPath))
+	host := hex.EncodeToString(sum[:8]) + unixSocketHostSuffix
+	unixSockets.Store(host, socketPath)
+	return "http://" + host + requestPath
+}
+
+// validateUnixTarget checks that a unix:// target names a socket path
+func validateUnixTarget(targetURL string) error {
+	socketPath, _ := splitUnixTarget(targetURL)
+	if !strings.HasPrefix(socketPath, "/") {
+		return fmt.Errorf("unix socket path must be absolute (unix:///path/to.sock)")
+	}
+	return nil
+}
+
+// unixSocketFor returns the socket path behind a placeholder host, if any
+func unixSocketFor(host string) (string, bool) {
+	if !strings.HasSuffix(host, unixSocketHostSuffix) {
+		return "", false
+	}
+	socketPath, ok := unixSockets.Load(host)
+	if !ok {
+		return "", false
+	}
+	return socketPath.(string), true
+}
+
+// dialUnixOrTCP wraps the transport's dialer so placeholder hosts dial their unix socket
+func dialUnixOrTCP(dialer *net.Dialer, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err == nil {
+			if socketPath, ok := unixSocketFor(host); ok {
+				return dialer.DialContext(ctx, "unix", socketPath)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
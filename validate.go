@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// validateRelayConfig returns every problem found in a single relay configuration
+func validateRelayConfig(config RelayConfig) []string {
+	var problems []string
+	if config.RepoKey == "" {
+		problems = append(problems, fmt.Sprintf("relay %d: repo key is empty", config.Index))
+	}
+	for _, key := range config.BindKeys {
+		if err := validateRoutingKey(key, exchangeType()); err != nil {
+			problems = append(problems, fmt.Sprintf("relay %d: invalid repo key %q: %v", config.Index, key, err))
+		}
+	}
+	// 비어 있으면 접속할 때마다 알아보기 힘든 오류만 남기고 재시도를 반복하므로 시작할 때 막는다.
+	if config.BrokerAddr == "" {
+		problems = append(problems, fmt.Sprintf("relay %d: no broker address (set RMQ_ADDR_ROOT%s)", config.Index, perRelayHint("RMQ_ADDR", config.Index)))
+	} else if err := validateBrokerAddr(config.BrokerAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid broker address %q: %v", config.Index, redactURL(config.BrokerAddr), err))
+	}
+	if config.Exchange == "" {
+		problems = append(problems, fmt.Sprintf("relay %d: no exchange (set RMQ_EXCHANGE_NAME%s)", config.Index, perRelayHint("RELAY_EXCHANGE", config.Index)))
+	}
+	if config.routesErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_ROUTES: %v", config.Index, config.routesErr))
+	} else if len(config.allTargetURLs()) == 0 {
+		problems = append(problems, fmt.Sprintf("relay %d: no target URL", config.Index))
+	}
+	if !slices.Contains(supportedMethods, config.Method) {
+		problems = append(problems, fmt.Sprintf("relay %d: unsupported RELAY_METHOD %q (supported: %s)",
+			config.Index, config.Method, strings.Join(supportedMethods, ", ")))
+	}
+	// 잘못 쓰면 받는 쪽이 기대와 다른 형식의 본문을 받으므로 기본값으로 바꾸지 않고 막는다.
+	if !slices.Contains(supportedForwardFormats, config.ForwardFormat) {
+		problems = append(problems, fmt.Sprintf("relay %d: unsupported FORWARD_FORMAT %q (supported: %s)",
+			config.Index, config.ForwardFormat, strings.Join(supportedForwardFormats, ", ")))
+	}
+	// fanout으로 바꾸면 대상 하나에 보낼 메시지가 모든 대상으로 복제되므로 막는다.
+	if !slices.Contains(supportedLBModes, config.LBMode) {
+		problems = append(problems, fmt.Sprintf("relay %d: unsupported RELAY_LB_MODE %q (supported: %s)",
+			config.Index, config.LBMode, strings.Join(supportedLBModes, ", ")))
+	}
+	if !slices.Contains(supportedBackpressureModes, config.BackpressureMode) {
+		problems = append(problems, fmt.Sprintf("relay %d: unsupported BACKPRESSURE_MODE %q (supported: %s)",
+			config.Index, config.BackpressureMode, strings.Join(supportedBackpressureModes, ", ")))
+	}
+	if _, ok := signAlgorithms[config.SignAlgo]; !ok {
+		problems = append(problems, fmt.Sprintf("relay %d: unsupported RELAY_SIGN_ALGO %q (supported: hmac-sha256, hmac-sha512, hmac-sha1)", config.Index, config.SignAlgo))
+	}
+	if config.SignHeader != "" && config.SignSecret == "" {
+		problems = append(problems, fmt.Sprintf("relay %d: RELAY_SIGN_HEADER is set without RELAY_SIGN_SECRET", config.Index))
+	} else if config.SignHeader == "" && config.SignSecret != "" {
+		problems = append(problems, fmt.Sprintf("relay %d: RELAY_SIGN_SECRET is set without RELAY_SIGN_HEADER", config.Index))
+	}
+	switch config.QueueType {
+	case queueTypeClassic:
+	case queueTypeQuorum:
+		// quorum 큐는 exclusive/auto-delete가 될 수 없으므로 이름 있는 durable 큐만 가능하다.
+		if !config.QueueDurable {
+			problems = append(problems, fmt.Sprintf("relay %d: RELAY_QUEUE_TYPE=quorum requires RMQ_QUEUE_NAME and RMQ_QUEUE_DURABLE=1 (quorum queues cannot be exclusive or auto-delete)", config.Index))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("relay %d: unsupported RELAY_QUEUE_TYPE %q (supported: classic, quorum)", config.Index, config.QueueType))
+	}
+	if config.tlsErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_TLS_* settings: %v", config.Index, config.tlsErr))
+	}
+	if config.successCodesErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_SUCCESS_CODES: %v", config.Index, config.successCodesErr))
+	}
+	if config.queryMapErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_QUERY_MAP: %v", config.Index, config.queryMapErr))
+	}
+	if config.branchFilterErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_BRANCH_FILTER: %v", config.Index, config.branchFilterErr))
+	}
+	if config.headersErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_HEADERS: %v", config.Index, config.headersErr))
+	}
+	if config.proxyErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_PROXY_URL / HTTP_PROXY_URL: %v", config.Index, config.proxyErr))
+	}
+	if config.authTypeErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_AUTH_TYPE: %v", config.Index, config.authTypeErr))
+	}
+	if config.templateErr != nil {
+		problems = append(problems, fmt.Sprintf("relay %d: invalid RELAY_TEMPLATE: %v", config.Index, config.templateErr))
+	}
+	for _, targetURL := range config.allTargetURLs() {
+		// 자리 표시자는 repo key로 채워 본 결과로 검사한다.
+		if err := validateTargetURL(expandTargetURL(targetURL, config.RepoKey, config.RepoKey)); err != nil {
+			problems = append(problems, fmt.Sprintf("relay %d: invalid target URL %q: %v", config.Index, targetURL, err))
+		}
+	}
+	return problems
+}
+
+// normalizeTargetURLs fixes obvious mistakes in the relay's target URLs (RELAY_TARGET_URL and RELAY_ROUTES)
+// before validation, logging each rewrite so the operator can correct the setting.
+func normalizeTargetURLs(config RelayConfig) RelayConfig {
+	normalize := func(urls []string) []string {
+		normalized := make([]string, len(urls))
+		for i, targetURL := range urls {
+			normalized[i] = normalizeTargetURL(targetURL)
+			if normalized[i] != targetURL {
+				relayLogger(config).Warn("Target URL has no scheme. Assuming http://.",
+					"target_url", redactURL(targetURL), "normalized", redactURL(normalized[i]))
+			}
+		}
+		return normalized
+	}
+
+	config.TargetURLs = normalize(config.TargetURLs)
+	routes := make([]targetRoute, len(config.Routes))
+	for i, route := range config.Routes {
+		routes[i] = targetRoute{Pattern: route.Pattern, TargetURLs: normalize(route.TargetURLs)}
+	}
+	config.Routes = routes
+	return config
+}
+
+// normalizeTargetURL prefixes http:// to a target without a scheme ("myhost:8080/build", "//myhost/build").
+// url.Parse would read "myhost" as the scheme, so every request would fail with a confusing error.
+func normalizeTargetURL(targetURL string) string {
+	if isUnixTarget(targetURL) || strings.Contains(targetURL, "://") {
+		return targetURL
+	}
+	return "http://" + strings.TrimPrefix(targetURL, "//")
+}
+
+// perRelayHint returns " or NAME_<index>" for numbered relays, nothing for the legacy single relay
+func perRelayHint(name string, index int) string {
+	if index == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" or %s_%d", name, index)
+}
+
+// validateBrokerAddr checks that addr is an amqp:// or amqps:// URI.
+// url.Parse errors quote the whole address, so only the cause is returned to keep the password out of the logs.
+func validateBrokerAddr(addr string) error {
+	_, err := amqp.ParseURI(addr)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// validateTargetURL checks that targetURL is an absolute http/https URL or a unix:// socket target
+func validateTargetURL(targetURL string) error {
+	if isUnixTarget(targetURL) {
+		return validateUnixTarget(targetURL)
+	}
+	if strings.Contains(targetURL, "{{") {
+		return fmt.Errorf("unknown placeholder (supported: %s, %s)", placeholderRepoKey, placeholderRoutingKey)
+	}
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+// reportConfigProblems logs a consolidated report of invalid relays.
+// Returns an error unless RELAY_ALLOW_PARTIAL=1, in which case the invalid relays are skipped.
+func reportConfigProblems(problems []string, allowPartial bool) error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, problem := range problems {
+		slog.Error("Invalid relay configuration", "problem", problem)
+	}
+
+	if !allowPartial {
+		slog.Error("Relay configuration is invalid. Fix the problems above or set RELAY_ALLOW_PARTIAL=1 to skip invalid relays.",
+			"problems", len(problems))
+		return fmt.Errorf("%d relay configuration problem(s)", len(problems))
+	}
+	slog.Warn("RELAY_ALLOW_PARTIAL is enabled. Skipping invalid relays.", "problems", len(problems))
+	return nil
+}
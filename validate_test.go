@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// enumProblems returns the problems validateRelayConfig reports for FORWARD_FORMAT, RELAY_AUTH_TYPE and RELAY_LB_MODE
+func enumProblems(config RelayConfig) []string {
+	var problems []string
+	for _, problem := range validateRelayConfig(config) {
+		if strings.Contains(problem, "FORWARD_FORMAT") || strings.Contains(problem, "RELAY_AUTH_TYPE") || strings.Contains(problem, "RELAY_LB_MODE") {
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+func TestValidateRelayConfigEnums(t *testing.T) {
+	tests := []struct {
+		name         string
+		format       string
+		authType     string
+		lbMode       string
+		wantProblems int
+	}{
+		{name: "defaults", wantProblems: 0},
+		{name: "supported values in any case", format: "JSON", authType: "Bearer", lbMode: "RoundRobin", wantProblems: 0},
+		// 오타를 기본값으로 바꾸면 다른 형식, 인증 없음, 모든 대상 복제로 조용히 동작하므로 시작하지 않는다.
+		{name: "typos", format: "jsn", authType: "bearre", lbMode: "round-robin", wantProblems: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FORWARD_FORMAT", tt.format)
+			t.Setenv("RELAY_AUTH_TYPE", tt.authType)
+			t.Setenv("RELAY_LB_MODE", tt.lbMode)
+			if problems := enumProblems(testRelayConfig("http://ci.example.com/github-webhook/")); len(problems) != tt.wantProblems {
+				t.Errorf("got %d problem(s) %q, want %d", len(problems), problems, tt.wantProblems)
+			}
+		})
+	}
+}
+
+func TestValidateRelayConfigFileEnums(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relays.yaml")
+	data := `relays:
+  - repo_key: MyOrg.my-repo
+    target_url: http://ci.example.com/github-webhook/
+    forward_format: jsn
+    auth:
+      type: bearre
+  - repo_key: MyOrg.other-repo
+    target_url: http://ci.example.com/github-webhook/
+    forward_format: multipart
+    auth:
+      type: basic
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configs, err := loadRelayConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadRelayConfigFile: %v", err)
+	}
+
+	// 파일 값도 환경 변수와 같은 검증을 거친다.
+	if problems := enumProblems(configs[0]); len(problems) != 2 {
+		t.Errorf("relay 1: got problems %q, want FORWARD_FORMAT and RELAY_AUTH_TYPE", problems)
+	}
+	if problems := enumProblems(configs[1]); len(problems) != 0 {
+		t.Errorf("relay 2: got problems %q, want none", problems)
+	}
+}
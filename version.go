@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+// Build metadata, set with -ldflags at build time:
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// versionString is printed by -version
+func versionString() string {
+	return fmt.Sprintf("github-mq-to-post-relay %s (commit %s, built %s)", version, commit, buildDate)
+}
+
+// defaultUserAgent is sent on forward requests unless RELAY_USER_AGENT is set
+func defaultUserAgent() string {
+	return "github-mq-to-post-relay/" + version
+}